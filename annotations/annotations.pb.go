@@ -0,0 +1,444 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: annotations/annotations.proto
+
+package annotations
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	descriptorpb "google.golang.org/protobuf/types/descriptorpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// A security requirement lists the security schemes a request has to satisfy at once.
+// See: https://swagger.io/specification/#security-requirement-object
+type SecurityRequirement struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Schemes       []*RequiredScheme      `protobuf:"bytes,1,rep,name=schemes,proto3" json:"schemes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SecurityRequirement) Reset() {
+	*x = SecurityRequirement{}
+	mi := &file_annotations_annotations_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SecurityRequirement) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SecurityRequirement) ProtoMessage() {}
+
+func (x *SecurityRequirement) ProtoReflect() protoreflect.Message {
+	mi := &file_annotations_annotations_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SecurityRequirement.ProtoReflect.Descriptor instead.
+func (*SecurityRequirement) Descriptor() ([]byte, []int) {
+	return file_annotations_annotations_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SecurityRequirement) GetSchemes() []*RequiredScheme {
+	if x != nil {
+		return x.Schemes
+	}
+	return nil
+}
+
+// A security scheme of the OpenAPI description together with the scopes a request needs.
+type RequiredScheme struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The name of the security scheme inside of 'components.securitySchemes' (e.g.: 'petstore_auth').
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// The type of the security scheme: 'apiKey', 'http', 'oauth2' or 'openIdConnect'.
+	Type string `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	// The scopes that are required for OAuth2 and OpenID Connect (e.g.: 'write:pets').
+	Scopes        []string `protobuf:"bytes,3,rep,name=scopes,proto3" json:"scopes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RequiredScheme) Reset() {
+	*x = RequiredScheme{}
+	mi := &file_annotations_annotations_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RequiredScheme) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RequiredScheme) ProtoMessage() {}
+
+func (x *RequiredScheme) ProtoReflect() protoreflect.Message {
+	mi := &file_annotations_annotations_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RequiredScheme.ProtoReflect.Descriptor instead.
+func (*RequiredScheme) Descriptor() ([]byte, []int) {
+	return file_annotations_annotations_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *RequiredScheme) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *RequiredScheme) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *RequiredScheme) GetScopes() []string {
+	if x != nil {
+		return x.Scopes
+	}
+	return nil
+}
+
+// A header or cookie parameter of an operation.
+type MetadataParameter struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The name of the parameter (e.g.: 'X-Request-ID').
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// The location of the parameter: 'header' or 'cookie'.
+	In string `protobuf:"bytes,2,opt,name=in,proto3" json:"in,omitempty"`
+	// The metadata key that carries the parameter: the lowercase name of a header or 'cookie' for cookies.
+	Key string `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
+	// Whether the parameter is required.
+	Required bool `protobuf:"varint,4,opt,name=required,proto3" json:"required,omitempty"`
+	// The description of the parameter.
+	Description   string `protobuf:"bytes,5,opt,name=description,proto3" json:"description,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetadataParameter) Reset() {
+	*x = MetadataParameter{}
+	mi := &file_annotations_annotations_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetadataParameter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetadataParameter) ProtoMessage() {}
+
+func (x *MetadataParameter) ProtoReflect() protoreflect.Message {
+	mi := &file_annotations_annotations_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetadataParameter.ProtoReflect.Descriptor instead.
+func (*MetadataParameter) Descriptor() ([]byte, []int) {
+	return file_annotations_annotations_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *MetadataParameter) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *MetadataParameter) GetIn() string {
+	if x != nil {
+		return x.In
+	}
+	return ""
+}
+
+func (x *MetadataParameter) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *MetadataParameter) GetRequired() bool {
+	if x != nil {
+		return x.Required
+	}
+	return false
+}
+
+func (x *MetadataParameter) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+// A header of a response of an operation.
+type ResponseHeader struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The name of the header (e.g.: 'X-RateLimit-Remaining').
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// The metadata key that carries the header: the lowercase name of the header.
+	Key string `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	// The status code of the response that has the header (e.g.: '200' or 'default').
+	Status string `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	// Whether the response always has the header.
+	Required bool `protobuf:"varint,4,opt,name=required,proto3" json:"required,omitempty"`
+	// The description of the header.
+	Description   string `protobuf:"bytes,5,opt,name=description,proto3" json:"description,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResponseHeader) Reset() {
+	*x = ResponseHeader{}
+	mi := &file_annotations_annotations_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResponseHeader) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResponseHeader) ProtoMessage() {}
+
+func (x *ResponseHeader) ProtoReflect() protoreflect.Message {
+	mi := &file_annotations_annotations_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResponseHeader.ProtoReflect.Descriptor instead.
+func (*ResponseHeader) Descriptor() ([]byte, []int) {
+	return file_annotations_annotations_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ResponseHeader) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ResponseHeader) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *ResponseHeader) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *ResponseHeader) GetRequired() bool {
+	if x != nil {
+		return x.Required
+	}
+	return false
+}
+
+func (x *ResponseHeader) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+var file_annotations_annotations_proto_extTypes = []protoimpl.ExtensionInfo{
+	{
+		ExtendedType:  (*descriptorpb.MethodOptions)(nil),
+		ExtensionType: ([]*SecurityRequirement)(nil),
+		Field:         52001,
+		Name:          "gnostic.grpc.security",
+		Tag:           "bytes,52001,rep,name=security",
+		Filename:      "annotations/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.MethodOptions)(nil),
+		ExtensionType: ([]*MetadataParameter)(nil),
+		Field:         52002,
+		Name:          "gnostic.grpc.request_metadata",
+		Tag:           "bytes,52002,rep,name=request_metadata",
+		Filename:      "annotations/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.MethodOptions)(nil),
+		ExtensionType: ([]*ResponseHeader)(nil),
+		Field:         52003,
+		Name:          "gnostic.grpc.response_headers",
+		Tag:           "bytes,52003,rep,name=response_headers",
+		Filename:      "annotations/annotations.proto",
+	},
+}
+
+// Extension fields to descriptorpb.MethodOptions.
+var (
+	// The security requirements of the operation. A request has to satisfy one of them. RPCs without security
+	// requirements can be called without credentials.
+	//
+	// repeated gnostic.grpc.SecurityRequirement security = 52001;
+	E_Security = &file_annotations_annotations_proto_extTypes[0]
+	// The header and cookie parameters of the operation. gRPC carries them as metadata of the request, so they are not
+	// part of the request message.
+	//
+	// repeated gnostic.grpc.MetadataParameter request_metadata = 52002;
+	E_RequestMetadata = &file_annotations_annotations_proto_extTypes[1]
+	// The headers of the responses of the operation. gRPC sends them as header metadata of the response, which gRPC-JSON
+	// transcoding turns into HTTP headers.
+	//
+	// repeated gnostic.grpc.ResponseHeader response_headers = 52003;
+	E_ResponseHeaders = &file_annotations_annotations_proto_extTypes[2]
+)
+
+var File_annotations_annotations_proto protoreflect.FileDescriptor
+
+const file_annotations_annotations_proto_rawDesc = "" +
+	"\n" +
+	"\x1dannotations/annotations.proto\x12\fgnostic.grpc\x1a google/protobuf/descriptor.proto\"M\n" +
+	"\x13SecurityRequirement\x126\n" +
+	"\aschemes\x18\x01 \x03(\v2\x1c.gnostic.grpc.RequiredSchemeR\aschemes\"P\n" +
+	"\x0eRequiredScheme\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x16\n" +
+	"\x06scopes\x18\x03 \x03(\tR\x06scopes\"\x87\x01\n" +
+	"\x11MetadataParameter\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x0e\n" +
+	"\x02in\x18\x02 \x01(\tR\x02in\x12\x10\n" +
+	"\x03key\x18\x03 \x01(\tR\x03key\x12\x1a\n" +
+	"\brequired\x18\x04 \x01(\bR\brequired\x12 \n" +
+	"\vdescription\x18\x05 \x01(\tR\vdescription\"\x8c\x01\n" +
+	"\x0eResponseHeader\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x16\n" +
+	"\x06status\x18\x03 \x01(\tR\x06status\x12\x1a\n" +
+	"\brequired\x18\x04 \x01(\bR\brequired\x12 \n" +
+	"\vdescription\x18\x05 \x01(\tR\vdescription:_\n" +
+	"\bsecurity\x12\x1e.google.protobuf.MethodOptions\x18\xa1\x96\x03 \x03(\v2!.gnostic.grpc.SecurityRequirementR\bsecurity:l\n" +
+	"\x10request_metadata\x12\x1e.google.protobuf.MethodOptions\x18\xa2\x96\x03 \x03(\v2\x1f.gnostic.grpc.MetadataParameterR\x0frequestMetadata:i\n" +
+	"\x10response_headers\x12\x1e.google.protobuf.MethodOptions\x18\xa3\x96\x03 \x03(\v2\x1c.gnostic.grpc.ResponseHeaderR\x0fresponseHeadersB<Z:github.com/googleapis/gnostic-grpc/annotations;annotationsb\x06proto3"
+
+var (
+	file_annotations_annotations_proto_rawDescOnce sync.Once
+	file_annotations_annotations_proto_rawDescData []byte
+)
+
+func file_annotations_annotations_proto_rawDescGZIP() []byte {
+	file_annotations_annotations_proto_rawDescOnce.Do(func() {
+		file_annotations_annotations_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_annotations_annotations_proto_rawDesc), len(file_annotations_annotations_proto_rawDesc)))
+	})
+	return file_annotations_annotations_proto_rawDescData
+}
+
+var file_annotations_annotations_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_annotations_annotations_proto_goTypes = []any{
+	(*SecurityRequirement)(nil),        // 0: gnostic.grpc.SecurityRequirement
+	(*RequiredScheme)(nil),             // 1: gnostic.grpc.RequiredScheme
+	(*MetadataParameter)(nil),          // 2: gnostic.grpc.MetadataParameter
+	(*ResponseHeader)(nil),             // 3: gnostic.grpc.ResponseHeader
+	(*descriptorpb.MethodOptions)(nil), // 4: google.protobuf.MethodOptions
+}
+var file_annotations_annotations_proto_depIdxs = []int32{
+	1, // 0: gnostic.grpc.SecurityRequirement.schemes:type_name -> gnostic.grpc.RequiredScheme
+	4, // 1: gnostic.grpc.security:extendee -> google.protobuf.MethodOptions
+	4, // 2: gnostic.grpc.request_metadata:extendee -> google.protobuf.MethodOptions
+	4, // 3: gnostic.grpc.response_headers:extendee -> google.protobuf.MethodOptions
+	0, // 4: gnostic.grpc.security:type_name -> gnostic.grpc.SecurityRequirement
+	2, // 5: gnostic.grpc.request_metadata:type_name -> gnostic.grpc.MetadataParameter
+	3, // 6: gnostic.grpc.response_headers:type_name -> gnostic.grpc.ResponseHeader
+	7, // [7:7] is the sub-list for method output_type
+	7, // [7:7] is the sub-list for method input_type
+	4, // [4:7] is the sub-list for extension type_name
+	1, // [1:4] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_annotations_annotations_proto_init() }
+func file_annotations_annotations_proto_init() {
+	if File_annotations_annotations_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_annotations_annotations_proto_rawDesc), len(file_annotations_annotations_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 3,
+			NumServices:   0,
+		},
+		GoTypes:           file_annotations_annotations_proto_goTypes,
+		DependencyIndexes: file_annotations_annotations_proto_depIdxs,
+		MessageInfos:      file_annotations_annotations_proto_msgTypes,
+		ExtensionInfos:    file_annotations_annotations_proto_extTypes,
+	}.Build()
+	File_annotations_annotations_proto = out.File
+	file_annotations_annotations_proto_goTypes = nil
+	file_annotations_annotations_proto_depIdxs = nil
+}
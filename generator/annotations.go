@@ -0,0 +1,127 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	openapiv3 "github.com/google/gnostic/openapiv3"
+	"google.golang.org/protobuf/proto"
+	dpb "google.golang.org/protobuf/types/descriptorpb"
+)
+
+// The fields of OpenAPI elements that are rendered as options of gnostic's openapiv3/annotations.proto. The checker
+// doesn't report them if the options are rendered.
+var (
+	annotatedDocumentFields   = []string{"servers", "security", "externalDocs"}
+	annotatedComponentsFields = []string{"securitySchemes"}
+	annotatedOperationFields  = []string{"externalDocs", "security", "servers"}
+	annotatedSchemaFields     = []string{"title", "externalDocs", "example", "default", "required"}
+)
+
+// setDocumentAnnotation sets the option '(openapi.v3.document)' of 'fd' to the parts of 'document' that don't belong
+// to a message or RPC: the version of OpenAPI, 'info', 'servers', 'security', 'tags', 'externalDocs' and the security
+// schemes of the components. protoc-gen-openapi merges the option into the document it generates.
+func setDocumentAnnotation(fd *dpb.FileDescriptorProto, document *openapiv3.Document) {
+	if document == nil {
+		return
+	}
+	annotation := &openapiv3.Document{
+		Openapi:      document.Openapi,
+		Info:         document.Info,
+		Servers:      document.Servers,
+		Security:     document.Security,
+		Tags:         document.Tags,
+		ExternalDocs: document.ExternalDocs,
+	}
+	if securitySchemes := document.GetComponents().GetSecuritySchemes(); securitySchemes != nil {
+		annotation.Components = &openapiv3.Components{SecuritySchemes: securitySchemes}
+	}
+	if fd.Options == nil {
+		fd.Options = &dpb.FileOptions{}
+	}
+	proto.SetExtension(fd.Options, openapiv3.E_Document, proto.Clone(annotation))
+}
+
+// setOperationAnnotation sets the option '(openapi.v3.operation)' of 'md' to the fields of 'operation' that are not
+// represented by the RPC itself (e.g.: 'summary', 'security'). protoc-gen-openapi merges the option into the operation it
+// generates for the RPC. The 'operationId' is part of the option, since protoc-gen-openapi derives it from the name of
+// the RPC otherwise.
+func setOperationAnnotation(md *dpb.MethodDescriptorProto, operation *openapiv3.Operation) {
+	if operation == nil {
+		return
+	}
+	annotation := &openapiv3.Operation{
+		Tags:         operation.Tags,
+		Summary:      operation.Summary,
+		Description:  operation.Description,
+		ExternalDocs: operation.ExternalDocs,
+		OperationId:  operation.OperationId,
+		Security:     operation.Security,
+		Servers:      operation.Servers,
+	}
+	if proto.Size(annotation) == 0 {
+		return
+	}
+	if md.Options == nil {
+		md.Options = &dpb.MethodOptions{}
+	}
+	proto.SetExtension(md.Options, openapiv3.E_Operation, proto.Clone(annotation))
+}
+
+// setSchemaAnnotation sets the option '(openapi.v3.schema)' of 'message' to the annotated fields of 'schema', the
+// object schema the message was built from. protoc-gen-openapi merges the option into the schema of the message.
+func setSchemaAnnotation(message *dpb.DescriptorProto, schema *openapiv3.Schema) {
+	annotation := annotatedSchema(schema)
+	if annotation == nil {
+		return
+	}
+	if message.Options == nil {
+		message.Options = &dpb.MessageOptions{}
+	}
+	proto.SetExtension(message.Options, openapiv3.E_Schema, annotation)
+}
+
+// setPropertyAnnotation sets the option '(openapi.v3.property)' of 'fd' to the annotated fields of 'schema', the
+// schema the field was built from (e.g.: 'default' and 'example'). protoc-gen-openapi merges the option into the schema
+// of the property, so that the values are preserved if OpenAPI is generated from the .proto file.
+func setPropertyAnnotation(fd *dpb.FieldDescriptorProto, schema *openapiv3.Schema) {
+	annotation := annotatedSchema(schema)
+	if annotation == nil {
+		return
+	}
+	if fd.Options == nil {
+		fd.Options = &dpb.FieldOptions{}
+	}
+	proto.SetExtension(fd.Options, openapiv3.E_Property, annotation)
+}
+
+// annotatedSchema returns a copy of the fields of 'schema' that can't be represented by messages and fields: 'title',
+// 'description', 'default', 'example', 'externalDocs' and 'required'. It returns nil, if none of them is set.
+func annotatedSchema(schema *openapiv3.Schema) *openapiv3.Schema {
+	if schema == nil {
+		return nil
+	}
+	annotation := &openapiv3.Schema{
+		Title:        schema.Title,
+		Description:  schema.Description,
+		Default:      schema.Default,
+		Example:      schema.Example,
+		ExternalDocs: schema.ExternalDocs,
+		Required:     schema.Required,
+	}
+	if proto.Size(annotation) == 0 {
+		return nil
+	}
+	return proto.Clone(annotation).(*openapiv3.Schema)
+}
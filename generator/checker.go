@@ -15,8 +15,10 @@
 package generator
 
 import (
-	openapiv3 "github.com/googleapis/gnostic/openapiv3"
-	plugins "github.com/googleapis/gnostic/plugins"
+	"strings"
+
+	openapiv3 "github.com/google/gnostic/openapiv3"
+	plugins "github.com/google/gnostic/plugins"
 )
 
 type GrpcChecker struct {
@@ -24,6 +26,16 @@ type GrpcChecker struct {
 	document *openapiv3.Document
 	// The messages that are displayed to the user with information of what is not being processed by the generator.
 	messages []*plugins.Message
+	// If true, the validation keywords of schemas are rendered as buf.validate rules and not reported.
+	ValidationRules bool
+	// If true, the fields that are rendered as options of gnostic's openapiv3/annotations.proto are not reported (see
+	// annotations.go).
+	OpenAPIAnnotations bool
+	// If true, the fields that are rendered as options of annotations/annotations.proto are not reported (see
+	// grpc_annotations.go).
+	GrpcAnnotations bool
+	// If true, the tags of operations are used to group the operations into services and not reported.
+	ServicesByTag bool
 }
 
 // Creates a new checker.
@@ -41,6 +53,15 @@ func (c *GrpcChecker) Run() []*plugins.Message {
 func (c *GrpcChecker) analyzeOpenAPIDocument() {
 	fields := getNotSupportedOpenAPIDocumentFields(c.document)
 	for _, f := range fields {
+		if c.OpenAPIAnnotations && isDuplicate(annotatedDocumentFields, f) {
+			continue
+		}
+		if c.GrpcAnnotations && isDuplicate(grpcAnnotatedDocumentFields, f) {
+			continue
+		}
+		if c.ServicesByTag && f == "tags" {
+			continue
+		}
 		text := "Field: '" + f + "' is not supported for the OpenAPI document with title: " + c.document.Info.Title
 		msg := constructInfoMessage("DOCUMENTFIELDS", text, []string{f})
 		c.messages = append(c.messages, &msg)
@@ -56,6 +77,12 @@ func (c *GrpcChecker) analyzeComponents() {
 
 	fields := getNotSupportedComponentsFields(components)
 	for _, f := range fields {
+		if c.OpenAPIAnnotations && isDuplicate(annotatedComponentsFields, f) {
+			continue
+		}
+		if c.GrpcAnnotations && isDuplicate(grpcAnnotatedComponentsFields, f) {
+			continue
+		}
 		text := "Field: '" + f + "' is not supported for the component"
 		msg := constructInfoMessage("COMPONENTSFIELDS", text, append(copyKeys(currentKeys), f))
 		c.messages = append(c.messages, &msg)
@@ -66,6 +93,7 @@ func (c *GrpcChecker) analyzeComponents() {
 			parentKeys := append(currentKeys, []string{"schemas", pair.Name}...)
 			c.analyzeSchema(pair.Name, pair.Value, parentKeys)
 		}
+		c.analyzeRecursiveSchemas(schemas, currentKeys)
 	}
 
 	if responses := components.GetResponses(); responses != nil {
@@ -90,6 +118,31 @@ func (c *GrpcChecker) analyzeComponents() {
 	}
 }
 
+// Analyzes the references between the schemas of the components. Recursive schemas are rendered as messages that
+// reference themselves, which is fine as long as the recursion can end. If every step of the recursion is required,
+// no finite value of the schemas exists.
+func (c *GrpcChecker) analyzeRecursiveSchemas(schemas *openapiv3.SchemasOrReferences, parentKeys []string) {
+	names := make([]string, 0)
+	references := make(map[string][]string)
+	for _, pair := range schemas.AdditionalProperties {
+		names = append(names, pair.Name)
+		references[pair.Name] = requiredSchemaReferences(pair.Value.GetSchema())
+	}
+
+	for _, component := range stronglyConnectedComponents(names, references) {
+		if len(component) == 1 && !isDuplicate(references[component[0]], component[0]) {
+			continue
+		}
+		text := "The schemas '" + strings.Join(component, "', '") + "' require each other recursively. No finite " +
+			"value of them exists"
+		if len(component) == 1 {
+			text = "The schema '" + component[0] + "' requires itself recursively. No finite value of it exists"
+		}
+		msg := constructWarningMessage("RECURSION", text, append(copyKeys(parentKeys), "schemas", component[0]))
+		c.messages = append(c.messages, &msg)
+	}
+}
+
 // Analyzes all paths.
 func (c *GrpcChecker) analyzePaths() {
 	currentKeys := []string{"paths"}
@@ -129,6 +182,15 @@ func (c *GrpcChecker) analyzeOperation(operation *openapiv3.Operation, parentKey
 	}
 
 	for _, f := range fields {
+		if c.OpenAPIAnnotations && isDuplicate(annotatedOperationFields, f) {
+			continue
+		}
+		if c.GrpcAnnotations && isDuplicate(grpcAnnotatedOperationFields, f) {
+			continue
+		}
+		if c.ServicesByTag && f == "tags" {
+			continue
+		}
 		text := "Field: '" + f + "' is not supported for operation: " + operation.OperationId
 		msg := constructInfoMessage("OPERATIONFIELDS", text, append(copyKeys(currentKeys), f))
 		c.messages = append(c.messages, &msg)
@@ -161,8 +223,15 @@ func (c *GrpcChecker) analyzeParameter(paramOrRef *openapiv3.ParameterOrReferenc
 	currentKeys := parentKeys
 
 	if parameter := paramOrRef.GetParameter(); parameter != nil {
+		if isMetadataParameter(parameter.In) {
+			c.analyzeMetadataParameter(parameter, currentKeys)
+		}
+
 		fields := getNotSupportedParameterFields(parameter)
 		for _, f := range fields {
+			if c.GrpcAnnotations && isMetadataParameter(parameter.In) && isDuplicate(grpcAnnotatedParameterFields, f) {
+				continue
+			}
 			text := "Field: '" + f + "' is not supported for parameter: " + parameter.Name
 			msg := constructInfoMessage("PARAMETERFIELDS", text, append(copyKeys(currentKeys), f))
 			c.messages = append(c.messages, &msg)
@@ -173,6 +242,19 @@ func (c *GrpcChecker) analyzeParameter(paramOrRef *openapiv3.ParameterOrReferenc
 	}
 }
 
+// Describes how the header or cookie parameter 'parameter' is mapped. gRPC carries headers and cookies as metadata of
+// the request, which is only described if the options of annotations/annotations.proto are rendered.
+func (c *GrpcChecker) analyzeMetadataParameter(parameter *openapiv3.Parameter, parentKeys []string) {
+	text := "Parameter: '" + parameter.Name + "' in " + parameter.In + " is rendered as a field of the request message." +
+		" Set the parameter 'grpc_annotations' to read it from the gRPC metadata instead."
+	if c.GrpcAnnotations {
+		text = "Parameter: '" + parameter.Name + "' in " + parameter.In + " is not part of the request message. It is" +
+			" carried as gRPC metadata with the key: " + metadataKey(parameter)
+	}
+	msg := constructInfoMessage("METADATAPARAMETER", text, append(copyKeys(parentKeys), "in"))
+	c.messages = append(c.messages, &msg)
+}
+
 // Analyzes a response.
 func (c *GrpcChecker) analyzeResponse(pair *openapiv3.NamedResponseOrReference, parentKeys []string) {
 	currentKeys := append(parentKeys, pair.Name)
@@ -180,6 +262,9 @@ func (c *GrpcChecker) analyzeResponse(pair *openapiv3.NamedResponseOrReference,
 	if response := pair.Value.GetResponse(); response != nil {
 		fields := getNotSupportedResponseFields(response)
 		for _, f := range fields {
+			if c.GrpcAnnotations && isDuplicate(grpcAnnotatedResponseFields, f) {
+				continue
+			}
 			text := "Field: '" + f + "' is not supported for response: " + pair.Name
 			msg := constructInfoMessage("RESPONSEFIELDS", text, append(copyKeys(currentKeys), f))
 			c.messages = append(c.messages, &msg)
@@ -234,7 +319,21 @@ func (c *GrpcChecker) analyzeSchema(identifier string, schemaOrReference *openap
 
 	if schema := schemaOrReference.GetSchema(); schema != nil {
 		fields := getNotSupportedSchemaFields(schema)
+		validated := make([]string, 0)
+		if c.ValidationRules {
+			validated = validationRuleKeywords(schema, currentKeys)
+		}
 		for _, f := range fields {
+			if isDuplicate(validated, f) {
+				continue
+			}
+			if c.OpenAPIAnnotations && isDuplicate(annotatedSchemaFields, f) && isMessageOrFieldSchema(currentKeys) {
+				continue
+			}
+			if f == "deprecated" && isMessageOrFieldSchema(currentKeys) {
+				// Rendered as option 'deprecated' of the message or field.
+				continue
+			}
 			text := "Field: '" + f + "' is not supported for the schema: " + identifier
 			msg := constructInfoMessage("SCHEMAFIELDS", text, append(copyKeys(currentKeys), f))
 			c.messages = append(c.messages, &msg)
@@ -246,17 +345,6 @@ func (c *GrpcChecker) analyzeSchema(identifier string, schemaOrReference *openap
 			c.messages = append(c.messages, &msg2)
 		}
 
-		// Check for this: https://github.com/LorenzHW/gnostic-grpc-deprecated/issues/3#issuecomment-509348357
-		if additionalProperties := schema.AdditionalProperties; additionalProperties != nil {
-			if schema := additionalProperties.GetSchemaOrReference().GetSchema(); schema != nil {
-				if schema.Type == "array" {
-					text := "Field: 'additionalProperties' with type array is generated as empty message inside .proto."
-					msg := constructInfoMessage("SCHEMAFIELDS", text, append(copyKeys(currentKeys), "additionalProperties"))
-					c.messages = append(c.messages, &msg)
-				}
-			}
-		}
-
 		if items := schema.Items; items != nil {
 			for _, schemaOrRef := range items.SchemaOrReference {
 				pKeys := append(currentKeys, "items")
@@ -278,6 +366,32 @@ func (c *GrpcChecker) analyzeSchema(identifier string, schemaOrReference *openap
 	}
 }
 
+// requiredSchemaReferences returns the names of the component schemas that a value of 'schema' has to contain: schemas
+// of required properties (that are not arrays or maps) and schemas of 'allOf'. Inline schemas are searched as well.
+func requiredSchemaReferences(schema *openapiv3.Schema) []string {
+	references := make([]string, 0)
+	if schema == nil {
+		return references
+	}
+	add := func(schemaOrReference *openapiv3.SchemaOrReference) {
+		if ref := schemaOrReference.GetReference().GetXRef(); strings.HasPrefix(ref, "#/components/schemas/") {
+			references = append(references, referenceName(ref))
+		} else if s := schemaOrReference.GetSchema(); s != nil && isObjectSchema(s) {
+			references = append(references, requiredSchemaReferences(s)...)
+		}
+	}
+
+	for _, pair := range schema.GetProperties().GetAdditionalProperties() {
+		if isDuplicate(schema.Required, pair.Name) {
+			add(pair.Value)
+		}
+	}
+	for _, schemaOrReference := range schema.AllOf {
+		add(schemaOrReference)
+	}
+	return references
+}
+
 // constructInfoMessage Constructs a info message which will be displayed to the user on the console
 func constructInfoMessage(code string, text string, keys []string) plugins.Message {
 	return plugins.Message{
@@ -298,6 +412,16 @@ func constructWarningMessage(code string, text string, keys []string) plugins.Me
 	}
 }
 
+// constructErrorMessage constructs an error message which will be displayed to the user on the console
+func constructErrorMessage(code string, text string, keys []string) plugins.Message {
+	return plugins.Message{
+		Code:  code,
+		Level: plugins.Message_ERROR,
+		Text:  text,
+		Keys:  keys,
+	}
+}
+
 // Returns all valid operations that will be transcoded by the plugin.
 func getValidOperations(pathItem *openapiv3.PathItem) (operations []*openapiv3.Operation, operationTypes []string) {
 	operations = make([]*openapiv3.Operation, 0)
@@ -360,9 +484,6 @@ func getNotSupportedParameterFields(parameter *openapiv3.Parameter) []string {
 	if parameter.Required {
 		fields = append(fields, "required")
 	}
-	if parameter.Deprecated {
-		fields = append(fields, "deprecated")
-	}
 	if parameter.AllowEmptyValue {
 		fields = append(fields, "allowEmptyValue")
 	}
@@ -515,9 +636,6 @@ func getNotSupportedOperationFields(operation *openapiv3.Operation) []string {
 	if operation.Callbacks != nil {
 		fields = append(fields, "callbacks")
 	}
-	if operation.Deprecated {
-		fields = append(fields, "deprecated")
-	}
 	if operation.Security != nil {
 		fields = append(fields, "security")
 	}
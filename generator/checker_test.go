@@ -15,8 +15,8 @@
 package generator
 
 import (
-	openapiv3 "github.com/googleapis/gnostic/openapiv3"
-	plugins "github.com/googleapis/gnostic/plugins"
+	openapiv3 "github.com/google/gnostic/openapiv3"
+	plugins "github.com/google/gnostic/plugins"
 	"os/exec"
 	"testing"
 )
@@ -93,7 +93,214 @@ func TestFeatureCheckerOther(t *testing.T) {
 		{"components", "schemas", "Person", "required"},
 		{"components", "schemas", "Person", "properties", "name", "example"},
 		{"components", "schemas", "Person", "properties", "photoUrls", "xml"},
-		{"paths", "/testAdditionalPropertiesArray", "get", "responses", "200", "content", "application/json", "schema", "additionalProperties"},
+	}
+	validateKeys(t, expectedMessageKeys, messages)
+}
+
+func TestFeatureCheckerRecursion(t *testing.T) {
+	input := "testfiles/recursion.yaml"
+	documentv3, err := ParseOpenAPIDoc(input)
+	if err != nil {
+		t.Errorf("Error while parsing input file: %s", input)
+		return
+	}
+
+	checker := NewGrpcChecker(documentv3)
+	messages := checker.Run()
+	expectedMessageKeys := [][]string{
+		{"components", "schemas", "Chicken", "required"},
+		{"components", "schemas", "Egg", "required"},
+		{"components", "schemas", "Chicken"},
+		{"paths", "/categories/{id}", "get", "parameters", "required"},
+		{"paths", "/nodes", "post", "requestBody", "required"},
+	}
+	validateKeys(t, expectedMessageKeys, messages)
+	if len(messages) > 2 && (messages[2].Code != "RECURSION" || messages[2].Level != plugins.Message_WARNING) {
+		t.Errorf("Expected a warning for the recursive schemas 'Chicken' and 'Egg', got: %s", messages[2].Text)
+	}
+}
+
+func TestFeatureCheckerValidationRules(t *testing.T) {
+	input := "testfiles/validation.yaml"
+	documentv3, err := ParseOpenAPIDoc(input)
+	if err != nil {
+		t.Errorf("Error while parsing input file: %s", input)
+		return
+	}
+
+	checker := NewGrpcChecker(documentv3)
+	messages := checker.Run()
+	if len(messages) == 0 {
+		t.Errorf("Expected the validation keywords to be reported without validation rules")
+	}
+
+	// No rules are rendered for the values of maps and for keywords that don't apply to the type of the field.
+	checker = NewGrpcChecker(documentv3)
+	checker.ValidationRules = true
+	messages = checker.Run()
+	expectedMessageKeys := [][]string{
+		{"components", "schemas", "User", "properties", "labels", "additionalProperties", "maxLength"},
+		{"components", "schemas", "User", "properties", "count", "minLength"},
+	}
+	validateKeys(t, expectedMessageKeys, messages)
+}
+
+func TestFeatureCheckerOpenAPIAnnotations(t *testing.T) {
+	input := "testfiles/defaults.yaml"
+	documentv3, err := ParseOpenAPIDoc(input)
+	if err != nil {
+		t.Errorf("Error while parsing input file: %s", input)
+		return
+	}
+
+	checker := NewGrpcChecker(documentv3)
+	checker.OpenAPIAnnotations = true
+	messages := checker.Run()
+	validateKeys(t, [][]string{}, messages)
+
+	input = "testfiles/roundtrip.yaml"
+	documentv3, err = ParseOpenAPIDoc(input)
+	if err != nil {
+		t.Errorf("Error while parsing input file: %s", input)
+		return
+	}
+
+	// Tags are only used with the parameter 'services_by_tag'.
+	checker = NewGrpcChecker(documentv3)
+	checker.OpenAPIAnnotations = true
+	messages = checker.Run()
+	expectedMessageKeys := [][]string{
+		{"tags"},
+		{"paths", "/pets", "get", "tags"},
+		{"paths", "/pets", "post", "tags"},
+	}
+	validateKeys(t, expectedMessageKeys, messages)
+}
+
+func TestFeatureCheckerServicesByTag(t *testing.T) {
+	input := "testfiles/tags.yaml"
+	documentv3, err := ParseOpenAPIDoc(input)
+	if err != nil {
+		t.Errorf("Error while parsing input file: %s", input)
+		return
+	}
+
+	checker := NewGrpcChecker(documentv3)
+	messages := checker.Run()
+	expectedMessageKeys := [][]string{
+		{"tags"},
+		{"paths", "/pets", "get", "tags"},
+		{"paths", "/pets/{id}", "get", "tags"},
+		{"paths", "/pets/{id}", "get", "parameters", "required"},
+		{"paths", "/orders", "post", "tags"},
+		{"paths", "/user-accounts", "get", "tags"},
+	}
+	validateKeys(t, expectedMessageKeys, messages)
+
+	checker = NewGrpcChecker(documentv3)
+	checker.ServicesByTag = true
+	messages = checker.Run()
+	validateKeys(t, [][]string{{"paths", "/pets/{id}", "get", "parameters", "required"}}, messages)
+}
+
+func TestFeatureCheckerDeprecated(t *testing.T) {
+	input := "testfiles/deprecated.yaml"
+	documentv3, err := ParseOpenAPIDoc(input)
+	if err != nil {
+		t.Errorf("Error while parsing input file: %s", input)
+		return
+	}
+
+	checker := NewGrpcChecker(documentv3)
+	messages := checker.Run()
+	expectedMessageKeys := [][]string{
+		{"paths", "/books/{id}", "get", "parameters", "required"},
+	}
+	validateKeys(t, expectedMessageKeys, messages)
+}
+
+func TestFeatureCheckerGrpcAnnotations(t *testing.T) {
+	input := "testfiles/security.yaml"
+	documentv3, err := ParseOpenAPIDoc(input)
+	if err != nil {
+		t.Errorf("Error while parsing input file: %s", input)
+		return
+	}
+
+	checker := NewGrpcChecker(documentv3)
+	messages := checker.Run()
+	expectedMessageKeys := [][]string{
+		{"security"},
+		{"components", "securitySchemes"},
+		{"paths", "/pets", "post", "security"},
+	}
+	validateKeys(t, expectedMessageKeys, messages)
+
+	checker = NewGrpcChecker(documentv3)
+	checker.GrpcAnnotations = true
+	messages = checker.Run()
+	validateKeys(t, [][]string{}, messages)
+}
+
+func TestFeatureCheckerMetadataParameters(t *testing.T) {
+	input := "testfiles/headers.yaml"
+	documentv3, err := ParseOpenAPIDoc(input)
+	if err != nil {
+		t.Errorf("Error while parsing input file: %s", input)
+		return
+	}
+
+	checker := NewGrpcChecker(documentv3)
+	messages := checker.Run()
+	expectedMessageKeys := [][]string{
+		{"components", "parameters", "in"},
+		{"components", "parameters", "required"},
+		{"paths", "/pets", "get", "parameters", "in"},
+		{"paths", "/pets", "get", "parameters", "in"},
+		{"paths", "/pets/{petId}", "delete", "parameters", "required"},
+		{"paths", "/pets/{petId}", "delete", "parameters", "in"},
+		{"paths", "/pets/{petId}", "delete", "parameters", "required"},
+	}
+	validateKeys(t, expectedMessageKeys, messages)
+
+	checker = NewGrpcChecker(documentv3)
+	checker.GrpcAnnotations = true
+	messages = checker.Run()
+	expectedMessageKeys = [][]string{
+		{"components", "parameters", "in"},
+		{"paths", "/pets", "get", "parameters", "in"},
+		{"paths", "/pets", "get", "parameters", "in"},
+		{"paths", "/pets/{petId}", "delete", "parameters", "required"},
+		{"paths", "/pets/{petId}", "delete", "parameters", "in"},
+	}
+	validateKeys(t, expectedMessageKeys, messages)
+}
+
+func TestFeatureCheckerResponseHeaders(t *testing.T) {
+	input := "testfiles/responseHeaders.yaml"
+	documentv3, err := ParseOpenAPIDoc(input)
+	if err != nil {
+		t.Errorf("Error while parsing input file: %s", input)
+		return
+	}
+
+	checker := NewGrpcChecker(documentv3)
+	messages := checker.Run()
+	expectedMessageKeys := [][]string{
+		{"components", "headers"},
+		{"components", "responses", "NotFound", "headers"},
+		{"paths", "/pets", "get", "responses", "200", "headers"},
+		{"paths", "/pets", "get", "responses", "default", "headers"},
+		{"paths", "/pets/{petId}", "get", "parameters", "required"},
+		{"paths", "/pets/{petId}", "get", "responses", "200", "headers"},
+	}
+	validateKeys(t, expectedMessageKeys, messages)
+
+	checker = NewGrpcChecker(documentv3)
+	checker.GrpcAnnotations = true
+	messages = checker.Run()
+	expectedMessageKeys = [][]string{
+		{"paths", "/pets/{petId}", "get", "parameters", "required"},
 	}
 	validateKeys(t, expectedMessageKeys, messages)
 }
@@ -0,0 +1,366 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	plugins "github.com/google/gnostic/plugins"
+	"google.golang.org/protobuf/proto"
+	dpb "google.golang.org/protobuf/types/descriptorpb"
+)
+
+// The package and the file name of the shared messages.
+const (
+	commonPackage  = "common"
+	commonFileName = "common.proto"
+)
+
+// RenderWithCommonTypes renders the .proto files of several API descriptions at once, one renderer per description.
+// Messages that are structurally identical in at least two descriptions are moved into the shared file 'common.proto'
+// with the package 'common', which is imported by every file that uses them (see hoistCommonMessages).
+func RenderWithCommonTypes(renderers []*Renderer, response *plugins.Response) error {
+	rendered := len(response.Files)
+	packages := make(map[string]bool)
+	for _, renderer := range renderers {
+		if packages[renderer.Package] {
+			return errors.New("duplicate package name " + renderer.Package)
+		}
+		packages[renderer.Package] = true
+
+		fdSet, err := renderer.runFileDescriptorSetGenerator()
+		if err != nil {
+			return err
+		}
+		renderer.FdSet = fdSet
+		if err := renderer.validateFileDescriptors(response); err != nil {
+			return err
+		}
+	}
+
+	dependencies := make([]*dpb.FileDescriptorProto, 0)
+	dependencyNames := make(map[string]bool)
+	files := make([]*dpb.FileDescriptorProto, 0)
+	for _, renderer := range renderers {
+		mainProto := getLast(renderer.FdSet.File)
+		files = append(files, mainProto)
+		for _, fd := range renderer.FdSet.File {
+			if fd != mainProto && !dependencyNames[fd.GetName()] {
+				dependencyNames[fd.GetName()] = true
+				dependencies = append(dependencies, fd)
+			}
+		}
+	}
+
+	commonProto := hoistCommonMessages(files, dependencies)
+	if commonProto == nil {
+		// Nothing is shared, every file is rendered on its own.
+		if err := renderEach(renderers, response); err != nil {
+			return err
+		}
+		return renderers[0].renderDescriptorSet(response, rendered)
+	}
+
+	commonSet := &dpb.FileDescriptorSet{File: append(append([]*dpb.FileDescriptorProto{}, dependencies...), commonProto)}
+	f, err := renderers[0].RenderProto(commonSet, commonFileName)
+	if err != nil {
+		return err
+	}
+	response.Files = append(response.Files, f)
+
+	for _, renderer := range renderers {
+		mainProto := getLast(renderer.FdSet.File)
+		files := renderer.FdSet.File[:len(renderer.FdSet.File)-1]
+		renderer.FdSet.File = append(append([]*dpb.FileDescriptorProto{}, files...), commonProto, mainProto)
+	}
+	if err := renderEach(renderers, response); err != nil {
+		return err
+	}
+	// The parameters are the same for all renderers, a single FileDescriptorSet contains the files of all of them.
+	return renderers[0].renderDescriptorSet(response, rendered)
+}
+
+// renderEach renders the files of all renderers. Files of symbolic references that are shared by several renderers
+// are only rendered once.
+func renderEach(renderers []*Renderer, response *plugins.Response) error {
+	for _, renderer := range renderers {
+		rendererResponse := &plugins.Response{}
+		if err := renderer.renderFiles(rendererResponse, renderer.Package+".proto"); err != nil {
+			return err
+		}
+		for _, f := range rendererResponse.Files {
+			if !containsFile(response.Files, f.Name) {
+				response.Files = append(response.Files, f)
+			}
+		}
+	}
+	return nil
+}
+
+// containsFile checks whether 'files' contains a file with the name 'name'.
+func containsFile(files []*plugins.File, name string) bool {
+	for _, f := range files {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hoistCommonMessages moves the messages that are shared by 'files' into a new file with the package 'common' and
+// returns it. The references inside of 'files' are rewritten and 'common.proto' is imported where needed. Returns
+// nil, if no message is shared.
+//
+// Messages are shared if they are structurally identical in at least two files, regardless of their names and of the
+// other files that define a different message with the same name. Messages that reference messages of their own file
+// are only identical if the referenced messages are identical as well. A shared message is named after its first
+// occurrence (in the order of 'files'). If that name is taken by another shared message, the names of the other
+// occurrences are tried, before a number is appended (e.g.: 'Error2'). Requests and responses of RPCs are usually named
+// after their operations, they are only shared under their own name.
+func hoistCommonMessages(files []*dpb.FileDescriptorProto, dependencies []*dpb.FileDescriptorProto) *dpb.FileDescriptorProto {
+	occurrences := make([]*commonOccurrence, 0)
+	byName := make(map[int]map[string]*commonOccurrence) // The occurrences of each file by the names of the messages.
+	rpcMessages := make(map[int]map[string]bool)         // The requests and responses of the RPCs of each file.
+	for i, file := range files {
+		byName[i] = make(map[string]*commonOccurrence)
+		for _, m := range file.MessageType {
+			o := newCommonOccurrence(i, file.GetPackage(), m)
+			occurrences = append(occurrences, o)
+			byName[i][m.GetName()] = o
+		}
+		rpcMessages[i] = make(map[string]bool)
+		for _, s := range file.Service {
+			for _, m := range s.Method {
+				rpcMessages[i][strings.TrimPrefix(m.GetInputType(), file.GetPackage()+".")] = true
+				rpcMessages[i][strings.TrimPrefix(m.GetOutputType(), file.GetPackage()+".")] = true
+			}
+		}
+	}
+
+	// Messages start out in the same class if they are identical apart from the messages of their own files they
+	// reference. Classes are split until the messages of a class reference messages of the same classes.
+	for classes := 0; ; {
+		keys := make(map[string]int)
+		next := make([]int, len(occurrences))
+		for i, o := range occurrences {
+			key := o.key
+			if classes > 0 {
+				key = strconv.Itoa(o.class)
+				for _, ref := range o.references {
+					if r, ok := byName[o.file][ref]; ok {
+						key += "," + strconv.Itoa(r.class)
+					} else {
+						key += ",-"
+					}
+				}
+			}
+			if _, ok := keys[key]; !ok {
+				keys[key] = len(keys)
+			}
+			next[i] = keys[key]
+		}
+		for i, o := range occurrences {
+			o.class = next[i]
+		}
+		if len(keys) == classes {
+			break
+		}
+		classes = len(keys)
+	}
+
+	// A class is shared if it has occurrences in at least two files. Only the first occurrence of a file is moved.
+	members := make(map[int][]*commonOccurrence)
+	classOrder := make([]int, 0)
+	for _, o := range occurrences {
+		if _, ok := members[o.class]; !ok {
+			classOrder = append(classOrder, o.class)
+		}
+		if n := len(members[o.class]); n == 0 || members[o.class][n-1].file != o.file {
+			members[o.class] = append(members[o.class], o)
+		}
+	}
+	names := make(map[int]string)
+	taken := make(map[string]bool)
+	for _, class := range classOrder {
+		if len(members[class]) < 2 {
+			continue
+		}
+		name := members[class][0].message.GetName()
+		for _, o := range members[class] {
+			if !taken[o.message.GetName()] {
+				name = o.message.GetName()
+				break
+			}
+		}
+		shared := make([]*commonOccurrence, 0)
+		for _, o := range members[class] {
+			if o.message.GetName() == name || !rpcMessages[o.file][o.message.GetName()] {
+				shared = append(shared, o)
+			}
+		}
+		if len(shared) < 2 {
+			continue
+		}
+		members[class] = shared
+		names[class] = uniqueName(name, taken, "")
+	}
+	// A shared message can only be moved, if all messages it references are moved as well.
+	for removed := true; removed; {
+		removed = false
+		for class := range names {
+			first := members[class][0]
+			for _, ref := range first.references {
+				if r, ok := byName[first.file][ref]; !ok || names[r.class] == "" {
+					delete(names, class)
+					removed = true
+					break
+				}
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	syntax := "proto3"
+	pkg, fileName := commonPackage, commonFileName
+	commonProto := &dpb.FileDescriptorProto{Name: &fileName, Package: &pkg, Syntax: &syntax}
+	renamed := make([]map[string]string, len(files)) // Maps the names of the moved messages of a file to the new ones.
+	for i := range files {
+		renamed[i] = make(map[string]string)
+		for name, o := range byName[i] {
+			if n, ok := names[o.class]; ok {
+				renamed[i][name] = n
+			}
+		}
+	}
+	for _, class := range classOrder {
+		name, ok := names[class]
+		if !ok {
+			continue
+		}
+		first := members[class][0]
+		m := proto.Clone(first.message).(*dpb.DescriptorProto)
+		m.Name = proto.String(name)
+		descr := &dpb.FileDescriptorProto{MessageType: []*dpb.DescriptorProto{m}}
+		for old, n := range renamed[first.file] {
+			renameReferences(descr, files[first.file].GetPackage()+"."+old, commonPackage+"."+n)
+		}
+		commonProto.MessageType = append(commonProto.MessageType, m)
+	}
+	for _, dependency := range dependencies {
+		if usesMessagesOf(commonProto, dependency) {
+			commonProto.Dependency = append(commonProto.Dependency, dependency.GetName())
+		}
+	}
+
+	moved := make([]map[string]string, len(files))
+	for i := range files {
+		moved[i] = make(map[string]string)
+	}
+	for class, name := range names {
+		for _, o := range members[class] {
+			moved[o.file][o.message.GetName()] = name
+		}
+	}
+	for i, file := range files {
+		moveToCommon(file, moved[i])
+	}
+	return commonProto
+}
+
+// commonOccurrence is a message of one of the files that are checked for shared messages.
+type commonOccurrence struct {
+	// The index of the file that defines the message.
+	file    int
+	message *dpb.DescriptorProto
+	// The message without its name and with the references to messages of its own file replaced by placeholders.
+	key string
+	// The names of the messages of its own file the message references, in the order of the placeholders.
+	references []string
+	// The class of structurally identical messages the message belongs to.
+	class int
+}
+
+// newCommonOccurrence returns the occurrence of the message 'message' of the file at index 'file' with the package
+// 'pkg'.
+func newCommonOccurrence(file int, pkg string, message *dpb.DescriptorProto) *commonOccurrence {
+	o := &commonOccurrence{file: file, message: message, references: make([]string, 0)}
+	normalized := proto.Clone(message).(*dpb.DescriptorProto)
+	normalized.Name = nil
+	var replace func(messages []*dpb.DescriptorProto)
+	replace = func(messages []*dpb.DescriptorProto) {
+		for _, m := range messages {
+			for _, f := range m.Field {
+				if !strings.HasPrefix(f.GetTypeName(), pkg+".") {
+					continue
+				}
+				segments := strings.SplitN(strings.TrimPrefix(f.GetTypeName(), pkg+"."), ".", 2)
+				o.references = append(o.references, segments[0])
+				// Nested types (e.g.: map entries) are kept, they are part of the referenced message.
+				f.TypeName = proto.String(strings.TrimPrefix(f.GetTypeName(), pkg+"."+segments[0]))
+			}
+			replace(m.NestedType)
+		}
+	}
+	replace([]*dpb.DescriptorProto{normalized})
+	key, _ := proto.MarshalOptions{Deterministic: true}.Marshal(normalized)
+	o.key = string(key)
+	return o
+}
+
+// moveToCommon removes the messages 'moved' from 'file' and rewrites the references to them. 'moved' maps the names of
+// the messages to their names inside of the common package.
+func moveToCommon(file *dpb.FileDescriptorProto, moved map[string]string) {
+	// The spans of the messages change, they are set again below.
+	if file.SourceCodeInfo != nil {
+		locations := make([]*dpb.SourceCodeInfo_Location, 0)
+		for _, location := range file.SourceCodeInfo.Location {
+			if location.Path[0] != messageFieldNumber {
+				locations = append(locations, location)
+			}
+		}
+		file.SourceCodeInfo.Location = locations
+	}
+
+	used := false
+	for _, m := range append([]*dpb.DescriptorProto{}, file.MessageType...) {
+		if _, ok := moved[m.GetName()]; ok {
+			removeMessage(file, m)
+			used = true
+		}
+	}
+	for name, newName := range moved {
+		renameReferences(file, file.GetPackage()+"."+name, commonPackage+"."+newName)
+		for _, s := range file.Service {
+			for _, m := range s.Method {
+				if m.GetInputType() == name || m.GetInputType() == file.GetPackage()+"."+name {
+					m.InputType = proto.String(commonPackage + "." + newName)
+				}
+				if m.GetOutputType() == name || m.GetOutputType() == file.GetPackage()+"."+name {
+					m.OutputType = proto.String(commonPackage + "." + newName)
+				}
+			}
+		}
+	}
+	if used {
+		file.Dependency = append(file.Dependency, commonFileName)
+		sort.Strings(file.Dependency)
+	}
+	setSourceCodeSpans(file)
+}
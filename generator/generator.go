@@ -15,32 +15,68 @@
 package generator
 
 import (
+	"bytes"
+	"errors"
 	"log"
+	"net/url"
 	"os/exec"
-	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 
-	"github.com/golang/protobuf/descriptor"
-	"github.com/golang/protobuf/proto"
-	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
-	"github.com/golang/protobuf/ptypes/empty"
-	openapiv3 "github.com/googleapis/gnostic/openapiv3"
-	surface_v1 "github.com/googleapis/gnostic/surface"
+	openapiv3 "github.com/google/gnostic/openapiv3"
+	surface_v1 "github.com/google/gnostic/surface"
 	"google.golang.org/genproto/googleapis/api/annotations"
+	_ "google.golang.org/genproto/protobuf/field_mask"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	dpb "google.golang.org/protobuf/types/descriptorpb"
+	_ "google.golang.org/protobuf/types/known/anypb"
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/emptypb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 var protoBufScalarTypes = getProtobufTypes()
 
-// Gathers all symbolic references we generated in recursive calls.
-var generatedSymbolicReferences = make(map[string]bool, 0)
+// Gathers all symbolic references we generated in recursive calls. Maps the location of the referenced description to the
+// package of the generated .proto file.
+var generatedSymbolicReferences = make(map[string]string, 0)
 
 // Gathers all messages that have been generated from symbolic references in recursive calls.
 var generatedMessages = make(map[string]string, 0)
 
-var shouldRenderEmptyImport = false
+// Gathers the messages of symbolic references that were renamed, because descriptions that reference each other define
+// different messages with the same name (see mergeSymbolicFiles). Maps the location of the description and the original
+// name of the message (e.g.: 'https://example.com/models.yaml#Error') to the new name.
+var renamedSymbolicMessages = make(map[string]string, 0)
+
+// The files that can be used by the generated files: the Google API annotations and the well-known types. Their
+// descriptors are loaded from the protobuf registry, the Go packages that register them are imported above. Files come
+// after the files they import.
+var wellKnownFiles = []string{
+	"google/protobuf/descriptor.proto",
+	"google/protobuf/any.proto",
+	"google/protobuf/duration.proto",
+	"google/protobuf/empty.proto",
+	"google/protobuf/field_mask.proto",
+	"google/protobuf/struct.proto",
+	"google/protobuf/timestamp.proto",
+	"google/protobuf/wrappers.proto",
+	"google/api/http.proto",
+	"google/api/annotations.proto",
+	"google/api/field_behavior.proto",
+	"google/api/resource.proto",
+	"buf/validate/validate.proto",
+	"openapiv3/OpenAPIv3.proto",
+	"openapiv3/annotations.proto",
+	"annotations/annotations.proto",
+}
 
 // Uses the output of gnostic to return a dpb.FileDescriptorSet (in bytes). 'renderer' contains
 // the 'model' (surface model) which has all the relevant data to create the dpb.FileDescriptorSet.
@@ -54,6 +90,9 @@ var shouldRenderEmptyImport = false
 func (renderer *Renderer) runFileDescriptorSetGenerator() (fdSet *dpb.FileDescriptorSet, err error) {
 	syntax := "proto3"
 	n := renderer.Package + ".proto"
+	if renderer.fileName != "" {
+		n = renderer.fileName
+	}
 
 	// mainProto is the proto we ultimately want to render.
 	mainProto := &dpb.FileDescriptorProto{
@@ -65,12 +104,20 @@ func (renderer *Renderer) runFileDescriptorSetGenerator() (fdSet *dpb.FileDescri
 		File: []*dpb.FileDescriptorProto{mainProto},
 	}
 
-	buildDependencies(fdSet)
+	err = buildDependencies(fdSet)
+	if err != nil {
+		return nil, err
+	}
 	err = buildSymbolicReferences(fdSet, renderer)
 	if err != nil {
 		return nil, err
 	}
 
+	// gRPC carries header and cookie parameters as metadata, so they are not part of the request messages.
+	if renderer.GrpcAnnotations {
+		removeMetadataParameters(renderer.Model, newSchemaIndex(renderer.Document))
+	}
+
 	err = buildMessagesFromTypes(mainProto, renderer)
 	if err != nil {
 		return nil, err
@@ -81,24 +128,35 @@ func (renderer *Renderer) runFileDescriptorSetGenerator() (fdSet *dpb.FileDescri
 		return nil, err
 	}
 
+	// The files of symbolic references don't describe an API on their own, only the converted description does.
+	if renderer.OpenAPIAnnotations && renderer.location == "" {
+		setDocumentAnnotation(mainProto, renderer.Document)
+	}
+	if renderer.GoPackage != "" && renderer.location == "" {
+		if mainProto.Options == nil {
+			mainProto.Options = &dpb.FileOptions{}
+		}
+		mainProto.Options.GoPackage = proto.String(renderer.GoPackage)
+	}
+
+	if renderer.NestInlineMessages {
+		nestInlineMessages(mainProto, renderer)
+	}
+	setSourceCodeSpans(mainProto)
+
 	addDependencies(fdSet)
 
 	return fdSet, err
 }
 
 // addDependencies adds the dependencies to the FileDescriptorProto we want to render (the last one). This essentially
-// makes the 'import'  statements inside the .proto definition.
+// makes the 'import'  statements inside the .proto definition. Only the files whose messages or extensions are used
+// are imported (e.g.: files of symbolic references that are only needed by other symbolic references are not).
 func addDependencies(fdSet *dpb.FileDescriptorSet) {
 	// At last, we need to add the dependencies to the FileDescriptorProto in order to get them rendered.
 	lastFdProto := getLast(fdSet.File)
 	for _, fd := range fdSet.File {
-		if fd != lastFdProto {
-			if *fd.Name == "google/protobuf/empty.proto" { // Reference: https://github.com/googleapis/gnostic-grpc/issues/8
-				if shouldRenderEmptyImport {
-					lastFdProto.Dependency = append(lastFdProto.Dependency, *fd.Name)
-				}
-				continue
-			}
+		if fd != lastFdProto && (usesMessagesOf(lastFdProto, fd) || usesExtensionsOf(lastFdProto, fd)) {
 			lastFdProto.Dependency = append(lastFdProto.Dependency, *fd.Name)
 		}
 	}
@@ -106,115 +164,310 @@ func addDependencies(fdSet *dpb.FileDescriptorSet) {
 	sort.Strings(lastFdProto.Dependency)
 }
 
-// buildSymbolicReferences recursively generates all .proto definitions to external OpenAPI descriptions (URLs to other
-// descriptions inside the current description).
-func buildSymbolicReferences(fdSet *dpb.FileDescriptorSet, renderer *Renderer) (err error) {
-	symbolicReferences := renderer.Model.SymbolicReferences
-	symbolicReferences = trimAndRemoveDuplicates(symbolicReferences)
+// splitMessagesAndServices splits the last file of 'fdSet' into a file with the messages ('<name>_messages.proto') and
+// a file with the services ('<name>_service.proto') that imports the messages. Both files have the same package, so
+// references between them stay valid. It returns a FileDescriptorSet for each of the two files, which contains the
+// file as last element together with its dependencies.
+func splitMessagesAndServices(fdSet *dpb.FileDescriptorSet) (messagesSet *dpb.FileDescriptorSet, servicesSet *dpb.FileDescriptorSet) {
+	mainProto := getLast(fdSet.File)
+	baseName := strings.TrimSuffix(mainProto.GetName(), ".proto")
+	messagesFileName := baseName + "_messages.proto"
+	servicesFileName := baseName + "_service.proto"
+
+	messagesProto := &dpb.FileDescriptorProto{
+		Name:        &messagesFileName,
+		Package:     mainProto.Package,
+		Syntax:      mainProto.Syntax,
+		MessageType: mainProto.MessageType,
+	}
+	// Both files belong to the same Go package.
+	if goPackage := mainProto.GetOptions().GetGoPackage(); goPackage != "" {
+		messagesProto.Options = &dpb.FileOptions{GoPackage: proto.String(goPackage)}
+	}
+	servicesProto := &dpb.FileDescriptorProto{
+		Name:       &servicesFileName,
+		Package:    mainProto.Package,
+		Syntax:     mainProto.Syntax,
+		Dependency: []string{messagesFileName},
+		Service:    mainProto.Service,
+		Options:    mainProto.Options,
+	}
 
-	symbolicFileDescriptorProtos := make([]*dpb.FileDescriptorProto, 0)
-	for _, ref := range symbolicReferences {
-		if _, alreadyGenerated := generatedSymbolicReferences[ref]; !alreadyGenerated {
-			generatedSymbolicReferences[ref] = true
-
-			// Lets get the standard gnostic output from the symbolic reference.
-			cmd := exec.Command("gnostic", "--pb-out=-", ref)
-			b, err := cmd.Output()
-			if err != nil {
-				return err
-			}
+	imported := make(map[string]bool)
+	for _, name := range mainProto.Dependency {
+		imported[name] = true
+	}
+	dependencies := fdSet.File[:len(fdSet.File)-1]
+	for _, dependency := range dependencies {
+		if !imported[dependency.GetName()] {
+			continue
+		}
+		if usesMessagesOf(messagesProto, dependency) || usesExtensionsOf(messagesProto, dependency) {
+			messagesProto.Dependency = append(messagesProto.Dependency, dependency.GetName())
+		}
+		if usesMessagesOf(servicesProto, dependency) || usesExtensionsOf(servicesProto, dependency) {
+			servicesProto.Dependency = append(servicesProto.Dependency, dependency.GetName())
+		}
+	}
+	sort.Strings(messagesProto.Dependency)
+	sort.Strings(servicesProto.Dependency)
+
+	// The source code info (e.g.: comments) is split according to the elements it belongs to.
+	for _, location := range mainProto.GetSourceCodeInfo().GetLocation() {
+		file := messagesProto
+		if location.Path[0] == serviceFieldNumber {
+			file = servicesProto
+		}
+		if file.SourceCodeInfo == nil {
+			file.SourceCodeInfo = &dpb.SourceCodeInfo{}
+		}
+		file.SourceCodeInfo.Location = append(file.SourceCodeInfo.Location, location)
+	}
+
+	messagesSet = &dpb.FileDescriptorSet{File: append(append([]*dpb.FileDescriptorProto{}, dependencies...), messagesProto)}
+	servicesSet = &dpb.FileDescriptorSet{File: append(append([]*dpb.FileDescriptorProto{}, dependencies...), messagesProto, servicesProto)}
+	return messagesSet, servicesSet
+}
 
-			// Construct an OpenAPI document v3.
-			document, err := createOpenAPIDocFromGnosticOutput(b)
-			if err != nil {
-				return err
+// usesMessagesOf checks whether a field or a method of 'fd' uses one of the messages defined inside 'dependency'.
+func usesMessagesOf(fd *dpb.FileDescriptorProto, dependency *dpb.FileDescriptorProto) bool {
+	names := make(map[string]bool)
+	for _, m := range dependency.MessageType {
+		names[dependency.GetPackage()+"."+m.GetName()] = true
+	}
+
+	var usesMessages func(messages []*dpb.DescriptorProto) bool
+	usesMessages = func(messages []*dpb.DescriptorProto) bool {
+		for _, m := range messages {
+			for _, f := range m.Field {
+				if names[strings.TrimPrefix(f.GetTypeName(), ".")] {
+					return true
+				}
+			}
+			if usesMessages(m.NestedType) {
+				return true
 			}
+		}
+		return false
+	}
 
-			// Create the surface model. Keep in mind that this resolves the references of the symbolic reference again!
-			surfaceModel, err := surface_v1.NewModelFromOpenAPI3(document, ref)
-			if err != nil {
-				return err
+	if usesMessages(fd.MessageType) {
+		return true
+	}
+	for _, s := range fd.Service {
+		for _, m := range s.Method {
+			if names[m.GetInputType()] || names[m.GetOutputType()] {
+				return true
 			}
+		}
+	}
+	return false
+}
 
-			// Prepare surface model for recursive call. TODO: Keep discovery documents in mind.
-			inputDocumentType := "openapi.v3.Document"
-			if document.Openapi == "2.0.0" {
-				inputDocumentType = "openapi.v2.Document"
+// usesExtensionsOf checks whether an option of 'fd' (or of one of its messages, fields, services or RPCs) is an
+// extension defined inside 'dependency' (e.g.: the HTTP annotations of google/api/annotations.proto).
+func usesExtensionsOf(fd *dpb.FileDescriptorProto, dependency *dpb.FileDescriptorProto) bool {
+	extensions := make(map[protoreflect.FullName]bool)
+	for _, extension := range dependency.Extension {
+		extensions[protoreflect.FullName(dependency.GetPackage()+"."+extension.GetName())] = true
+	}
+	uses := func(options proto.Message) bool {
+		used := false
+		options.ProtoReflect().Range(func(field protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			used = field.IsExtension() && extensions[field.FullName()]
+			return !used
+		})
+		return used
+	}
+	if len(extensions) == 0 {
+		return false
+	}
+
+	var usesMessages func(messages []*dpb.DescriptorProto) bool
+	usesMessages = func(messages []*dpb.DescriptorProto) bool {
+		for _, m := range messages {
+			if uses(m.GetOptions()) || usesMessages(m.NestedType) {
+				return true
 			}
-			NewProtoLanguageModel().Prepare(surfaceModel, inputDocumentType)
-
-			// Recursively call the generator.
-			recursiveRenderer := NewRenderer(surfaceModel)
-			fileName := path.Base(ref)
-			recursiveRenderer.Package = strings.TrimSuffix(fileName, filepath.Ext(fileName))
-			newFdSet, err := recursiveRenderer.runFileDescriptorSetGenerator()
-			if err != nil {
-				return err
+			for _, f := range m.Field {
+				if uses(f.GetOptions()) {
+					return true
+				}
 			}
-			renderer.SymbolicFdSets = append(renderer.SymbolicFdSets, newFdSet)
+		}
+		return false
+	}
 
-			symbolicProto := getLast(newFdSet.File)
-			symbolicFileDescriptorProtos = append(symbolicFileDescriptorProtos, symbolicProto)
+	if uses(fd.GetOptions()) || usesMessages(fd.MessageType) {
+		return true
+	}
+	for _, s := range fd.Service {
+		if uses(s.GetOptions()) {
+			return true
+		}
+		for _, m := range s.Method {
+			if uses(m.GetOptions()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// buildSymbolicReferences generates all .proto definitions to external OpenAPI descriptions (URLs to other
+// descriptions inside the current description) and adds the ones the current description depends on to 'fdSet'.
+func buildSymbolicReferences(fdSet *dpb.FileDescriptorSet, renderer *Renderer) (err error) {
+	symbolicReferences := sortedSymbolicReferences(renderer.Model)
+
+	if renderer.symbolicFiles == nil {
+		// The renderer of the main description generates the files of all (transitively) referenced descriptions at
+		// once, so that cycles between them can be detected. The renderers of the references share these files.
+		generatedSymbolicReferences = make(map[string]string)
+		generatedMessages = make(map[string]string)
+		renamedSymbolicMessages = make(map[string]string)
+		renderer.symbolicFiles = make(map[string][]*dpb.FileDescriptorProto)
+		if err := renderer.generateSymbolicFiles(symbolicReferences); err != nil {
+			return err
 		}
 	}
 
+	// References to descriptions that are rendered into the current file (because of a cycle) are skipped, they are
+	// not generated yet.
+	symbolicFileDescriptorProtos := make([]*dpb.FileDescriptorProto, 0)
+	for _, ref := range symbolicReferences {
+		symbolicFileDescriptorProtos = appendFiles(symbolicFileDescriptorProtos, renderer.symbolicFiles[ref])
+	}
+
 	fdSet.File = append(symbolicFileDescriptorProtos, fdSet.File...)
 	return nil
 }
 
+// symbolicReferencePath returns the path of the .proto file for the symbolic reference 'ref' and its package. The path
+// mirrors the location of 'ref' relative to the directory 'base' (e.g.: 'v1/models.proto' with the package 'v1.models'
+// for 'https://example.com/specs/v1/models.yaml' and the base 'example.com/specs'). Files that would end up with the
+// same package get a number appended.
+func symbolicReferencePath(ref string, base []string) (fileName string, packageName string) {
+	segments := locationSegments(ref)
+	if hasPrefix(segments, base) {
+		segments = segments[len(base):]
+	}
+	segments[len(segments)-1] = trimExtensions(segments[len(segments)-1])
+
+	packageSegments := make([]string, len(segments))
+	for i, segment := range segments {
+		segment = invalidIdentifierCharacters.ReplaceAllString(segment, "_")
+		if segment[0] >= '0' && segment[0] <= '9' {
+			segment = "p" + segment // Identifiers have to start with a letter.
+		}
+		packageSegments[i] = segment
+	}
+	packageName = strings.Join(packageSegments, ".")
+
+	taken := make(map[string]bool)
+	for _, p := range generatedSymbolicReferences {
+		taken[p] = true
+	}
+	uniquePackageName := uniqueName(packageName, taken, "_")
+	if uniquePackageName != packageName {
+		segments[len(segments)-1] += strings.TrimPrefix(uniquePackageName, packageName)
+	}
+	return strings.Join(segments, "/") + ".proto", uniquePackageName
+}
+
+// locationSegments splits the location of a symbolic reference (an URL or an absolute file path) into its segments. The
+// fragment is ignored and the host of an URL becomes the first segment.
+func locationSegments(ref string) []string {
+	ref = strings.Split(ref, "#")[0]
+	location := ref
+	host := ""
+	if u, err := url.Parse(ref); err == nil && u.Host != "" {
+		location, host = u.Path, u.Host
+	}
+
+	segments := make([]string, 0)
+	if host != "" {
+		segments = append(segments, host)
+	}
+	for _, segment := range strings.Split(filepath.ToSlash(location), "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// commonDirectory returns the segments of the deepest directory that contains all locations of 'refs'.
+func commonDirectory(refs []string) []string {
+	var directory []string
+	for i, ref := range refs {
+		segments := locationSegments(ref)
+		segments = segments[:len(segments)-1]
+		if i == 0 {
+			directory = segments
+			continue
+		}
+		n := 0
+		for n < len(directory) && n < len(segments) && directory[n] == segments[n] {
+			n++
+		}
+		directory = directory[:n]
+	}
+	if directory == nil {
+		directory = make([]string, 0)
+	}
+	return directory
+}
+
+// hasPrefix checks whether 'segments' starts with 'prefix' and is longer than 'prefix'.
+func hasPrefix(segments []string, prefix []string) bool {
+	if len(segments) <= len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if segments[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // Protoreflect needs all the dependencies that are used inside of the FileDescriptorProto (that gets rendered)
-// to work properly. Those dependencies are google/protobuf/empty.proto, google/api/annotations.proto,
-// and "google/protobuf/descriptor.proto". For all those dependencies the corresponding
-// FileDescriptorProto has to be added to the FileDescriptorSet. Protoreflect won't work
-// if a reference is missing.
-func buildDependencies(fdSet *dpb.FileDescriptorSet) {
-	// Dependency to google/api/annotations.proto for gRPC-HTTP transcoding. Here a couple of problems arise:
-	// 1. Problem: 	We cannot call descriptor.ForMessage(&annotations.E_Http), which would be our
-	//				required dependency. However, we can call descriptor.ForMessage(&http) and
-	//				then construct the extension manually.
-	// 2. Problem: 	The name is set wrong.
-	// 3. Problem: 	google/api/annotations.proto has a dependency to google/protobuf/descriptor.proto.
-	http := annotations.Http{}
-	fd, _ := descriptor.MessageDescriptorProto(&http)
-
-	extensionName := "http"
-	n := "google/api/annotations.proto"
-	l := dpb.FieldDescriptorProto_LABEL_OPTIONAL
-	t := dpb.FieldDescriptorProto_TYPE_MESSAGE
-	tName := "google.api.HttpRule"
-	extendee := ".google.protobuf.MethodOptions"
-
-	httpExtension := &dpb.FieldDescriptorProto{
-		Name:     &extensionName,
-		Number:   &annotations.E_Http.Field,
-		Label:    &l,
-		Type:     &t,
-		TypeName: &tName,
-		Extendee: &extendee,
-	}
-
-	fd.Extension = append(fd.Extension, httpExtension)                        // 1. Problem
-	fd.Name = &n                                                              // 2. Problem
-	fd.Dependency = append(fd.Dependency, "google/protobuf/descriptor.proto") //3.rd Problem
-
-	// Build other required dependencies
-	e := empty.Empty{}
-	fdp := dpb.DescriptorProto{}
-	fd2, _ := descriptor.MessageDescriptorProto(&e)
-	fd3, _ := descriptor.MessageDescriptorProto(&fdp)
-	dependencies := []*dpb.FileDescriptorProto{fd, fd2, fd3}
+// to work properly. For all those dependencies the corresponding FileDescriptorProto has to be added to the
+// FileDescriptorSet. Protoreflect won't work if a reference is missing. The genuine descriptors of the well-known
+// files are added, so that every Google API annotation and well-known type can be used by the generated files.
+func buildDependencies(fdSet *dpb.FileDescriptorSet) error {
+	dependencies := make([]*dpb.FileDescriptorProto, 0)
+	for _, name := range wellKnownFiles {
+		fd, err := protoregistry.GlobalFiles.FindFileByPath(name)
+		if err != nil {
+			return errors.New("could not load the descriptor of " + name + ": " + err.Error())
+		}
+		dependencies = append(dependencies, protodesc.ToFileDescriptorProto(fd))
+	}
 
 	// According to the documentation of protoReflect.CreateFileDescriptorFromSet the file I want to print
 	// needs to be at the end of the array. All other FileDescriptorProto are dependencies.
 	fdSet.File = append(dependencies, fdSet.File...)
+	return nil
 }
 
 // buildMessagesFromTypes builds protobuf messages from the surface model types. If the type is a RPC request parameter
 // the fields have to follow certain rules, and therefore have to be validated.
 func buildMessagesFromTypes(descr *dpb.FileDescriptorProto, renderer *Renderer) (err error) {
+	index := newSchemaIndex(renderer.Document)
 	for _, t := range renderer.Model.Types {
 		message := &dpb.DescriptorProto{}
 		message.Name = &t.TypeName
+		renderer.setOrigin(message, index.lookupKeys(t.Name, ""))
+		if renderer.OpenAPIAnnotations {
+			setSchemaAnnotation(message, index.lookupType(t.Name))
+		}
+		if index.lookupType(t.Name).GetDeprecated() {
+			if message.Options == nil {
+				message.Options = &dpb.MessageOptions{}
+			}
+			message.Options.Deprecated = proto.Bool(true)
+		}
 
 		for i, f := range t.Fields {
 			if isRequestParameter(t) {
@@ -235,17 +488,35 @@ func buildMessagesFromTypes(descr *dpb.FileDescriptorProto, renderer *Renderer)
 			fieldDescriptor.Name = &f.FieldName
 			fieldDescriptor.Type = getFieldDescriptorType(f.NativeType, f.EnumValues)
 			setFieldDescriptorLabel(fieldDescriptor, f)
-			setFieldDescriptorTypeName(fieldDescriptor, f, renderer.Package)
+			setFieldDescriptorTypeName(fieldDescriptor, f, renderer)
+			setSymbolicReferenceTypeName(fieldDescriptor, index.lookupReference(t.Name, f.Name))
+			renderer.setOrigin(fieldDescriptor, index.lookupKeys(t.Name, f.Name))
+			if renderer.ValidationRules && f.Kind != surface_v1.FieldKind_MAP {
+				setValidationRules(fieldDescriptor, index.lookup(t.Name, f.Name))
+			}
+			if renderer.OpenAPIAnnotations {
+				setPropertyAnnotation(fieldDescriptor, index.lookup(t.Name, f.Name))
+			}
+			if index.lookup(t.Name, f.Name).GetDeprecated() || index.lookupParameter(t.Name, f.Name).GetDeprecated() {
+				if fieldDescriptor.Options == nil {
+					fieldDescriptor.Options = &dpb.FieldOptions{}
+				}
+				fieldDescriptor.Options.Deprecated = proto.Bool(true)
+			}
+			if !isParameterReference(t, f) {
+				setFieldDescriptorJsonName(fieldDescriptor, f)
+			}
 
 			// Maps are represented as nested types inside of the descriptor.
 			if f.Kind == surface_v1.FieldKind_MAP {
-				if strings.Contains(f.NativeType, "map[string][]") {
-					// Not supported for now: https://github.com/LorenzHW/gnostic-grpc-deprecated/issues/3#issuecomment-509348357
-					continue
-				}
-				mapDescriptorProto := buildMapDescriptorProto(f)
-				fieldDescriptor.TypeName = mapDescriptorProto.Name
+				parentName := renderer.Package + "." + *message.Name
+				mapDescriptorProto := buildMapDescriptorProto(f, parentName, renderer)
+				mapTypeName := parentName + "." + *mapDescriptorProto.Name
+				mapType := dpb.FieldDescriptorProto_TYPE_MESSAGE
+				fieldDescriptor.Type = &mapType
+				fieldDescriptor.TypeName = &mapTypeName
 				message.NestedType = append(message.NestedType, mapDescriptorProto)
+				renderer.origins[mapDescriptorProto] = renderer.origins[fieldDescriptor]
 			}
 			message.Field = append(message.Field, fieldDescriptor)
 		}
@@ -259,28 +530,21 @@ func buildMessagesFromTypes(descr *dpb.FileDescriptorProto, renderer *Renderer)
 // have to be set.
 func buildServiceFromMethods(descr *dpb.FileDescriptorProto, renderer *Renderer) (err error) {
 	methods := renderer.Model.Methods
-	serviceName := findValidServiceName(descr.MessageType, strings.Title(renderer.Package))
-
-	service := &dpb.ServiceDescriptorProto{
-		Name: &serviceName,
-	}
-	descr.Service = []*dpb.ServiceDescriptorProto{service}
+	services := make(map[string]*dpb.ServiceDescriptorProto) // Maps a tag to its service.
+	descr.Service = nil
 
 	for _, method := range methods {
+		service := getServiceForMethod(descr, renderer, method, services)
 		mOptionsDescr := &dpb.MethodOptions{}
 		requestBody := getRequestBodyForRequestParameters(method.ParametersTypeName, renderer.Model.Types)
 		httpRule := getHttpRuleForMethod(method, requestBody)
-		if err := proto.SetExtension(mOptionsDescr, annotations.E_Http, &httpRule); err != nil {
-			return err
-		}
+		proto.SetExtension(mOptionsDescr, annotations.E_Http, httpRule)
 
 		if method.ParametersTypeName == "" {
 			method.ParametersTypeName = "google.protobuf.Empty"
-			shouldRenderEmptyImport = true
 		}
 		if method.ResponsesTypeName == "" {
 			method.ResponsesTypeName = "google.protobuf.Empty"
-			shouldRenderEmptyImport = true
 		}
 
 		mDescr := &dpb.MethodDescriptorProto{
@@ -289,18 +553,259 @@ func buildServiceFromMethods(descr *dpb.FileDescriptorProto, renderer *Renderer)
 			OutputType: &method.ResponsesTypeName,
 			Options:    mOptionsDescr,
 		}
+		renderer.setOrigin(mDescr, []string{"paths", method.Path, strings.ToLower(method.Method)})
+		operation := findOperation(renderer.Document, method.Path, method.Method)
+		if operation.GetDeprecated() {
+			mOptionsDescr.Deprecated = proto.Bool(true)
+		}
+		if renderer.OpenAPIAnnotations {
+			setOperationAnnotation(mDescr, operation)
+		}
+		if renderer.GrpcAnnotations {
+			setSecurityAnnotation(mDescr, operation, renderer.Document)
+			setMetadataAnnotation(mDescr, operation, renderer.Document)
+			setResponseHeadersAnnotation(mDescr, operation, renderer.Document)
+		}
 
 		service.Method = append(service.Method, mDescr)
 	}
+	if len(descr.Service) == 0 {
+		getServiceForMethod(descr, renderer, nil, services)
+	}
 	return nil
 }
 
+// getServiceForMethod returns the service 'method' belongs to and adds it to 'descr' if it does not exist yet. If the
+// renderer splits services by tag, every operation is added to the service of its first tag. The description of the
+// tag becomes the comment of the service. Operations without tags are added to the service named after the package.
+func getServiceForMethod(descr *dpb.FileDescriptorProto, renderer *Renderer, method *surface_v1.Method,
+	services map[string]*dpb.ServiceDescriptorProto) *dpb.ServiceDescriptorProto {
+	tag := ""
+	if renderer.ServicesByTag && method != nil {
+		if operation := findOperation(renderer.Document, method.Path, method.Method); operation != nil && len(operation.Tags) > 0 {
+			tag = operation.Tags[0]
+		}
+	}
+	if service, ok := services[tag]; ok {
+		return service
+	}
+
+	// Packages of symbolic references consist of several segments (e.g.: 'a.models'), the last one names the service.
+	segments := strings.Split(renderer.Package, ".")
+	name := segments[len(segments)-1]
+	if tag != "" {
+		name = protoTypeName(invalidIdentifierCharacters.ReplaceAllString(tag, "_"))
+	}
+	serviceName := findValidServiceName(descr, renderer.NamingStrategy.ServiceName(name))
+	service := &dpb.ServiceDescriptorProto{Name: &serviceName}
+	descr.Service = append(descr.Service, service)
+	services[tag] = service
+
+	if description := findTagDescription(renderer.Document, tag); description != "" {
+		path := []int32{serviceFieldNumber, int32(len(descr.Service) - 1)}
+		addComment(descr, path, description)
+	}
+	return service
+}
+
+// The field numbers of 'message_type' and 'service' inside of FileDescriptorProto, used for paths of the source code
+// info.
+const (
+	messageFieldNumber = 4
+	serviceFieldNumber = 6
+)
+
+// setSourceCodeSpans sets the spans of the top-level messages and services of 'descr', if it has a source code info.
+// The printer orders elements with a source code info by their span, so every element gets a span that corresponds to
+// its position inside of 'descr': first the messages, then the services.
+func setSourceCodeSpans(descr *dpb.FileDescriptorProto) {
+	if descr.SourceCodeInfo == nil {
+		return
+	}
+	locations := make(map[[2]int32]*dpb.SourceCodeInfo_Location)
+	for _, location := range descr.SourceCodeInfo.Location {
+		if len(location.Path) == 2 {
+			locations[[2]int32{location.Path[0], location.Path[1]}] = location
+		}
+	}
+
+	line := int32(0)
+	setSpan := func(fieldNumber int32, count int) {
+		for i := 0; i < count; i++ {
+			location, ok := locations[[2]int32{fieldNumber, int32(i)}]
+			if !ok {
+				location = &dpb.SourceCodeInfo_Location{Path: []int32{fieldNumber, int32(i)}}
+				descr.SourceCodeInfo.Location = append(descr.SourceCodeInfo.Location, location)
+			}
+			location.Span = []int32{line, 0, 0}
+			line++
+		}
+	}
+	setSpan(messageFieldNumber, len(descr.MessageType))
+	setSpan(serviceFieldNumber, len(descr.Service))
+}
+
+// addComment adds 'comment' as leading comment of the element at 'path' to the source code info of 'descr'.
+// Reference: https://github.com/protocolbuffers/protobuf/blob/master/src/google/protobuf/descriptor.proto
+func addComment(descr *dpb.FileDescriptorProto, path []int32, comment string) {
+	if descr.SourceCodeInfo == nil {
+		descr.SourceCodeInfo = &dpb.SourceCodeInfo{}
+	}
+	lines := strings.Split(strings.TrimRight(comment, "\n"), "\n")
+	leadingComments := " " + strings.Join(lines, "\n ") + "\n"
+	location := &dpb.SourceCodeInfo_Location{Path: path, LeadingComments: &leadingComments}
+	descr.SourceCodeInfo.Location = append(descr.SourceCodeInfo.Location, location)
+}
+
+// nestInlineMessages moves messages that were built from inline object schemas into the message that uses them, if
+// there is exactly one such message. References to the moved messages are rewritten accordingly.
+func nestInlineMessages(descr *dpb.FileDescriptorProto, renderer *Renderer) {
+	index := newSchemaIndex(renderer.Document)
+	inlineMessages := make(map[string]string) // Maps the fully qualified name of a message to the name of the type.
+	for _, t := range renderer.Model.Types {
+		if index.isInline(t.Name) {
+			inlineMessages[renderer.Package+"."+t.TypeName] = t.TypeName
+		}
+	}
+
+	for {
+		messages := make(map[string]*dpb.DescriptorProto)
+		parents := make(map[string]map[string]bool)
+		collectMessages(descr.MessageType, renderer.Package, messages, parents)
+		for _, s := range descr.Service {
+			for _, m := range s.Method {
+				// Messages that are used as input or output of a RPC are not nested.
+				delete(inlineMessages, m.GetInputType())
+				delete(inlineMessages, m.GetOutputType())
+				delete(inlineMessages, renderer.Package+"."+m.GetInputType())
+				delete(inlineMessages, renderer.Package+"."+m.GetOutputType())
+			}
+		}
+
+		nested := false
+		for _, m := range descr.MessageType {
+			oldName := renderer.Package + "." + m.GetName()
+			if _, ok := inlineMessages[oldName]; !ok {
+				continue
+			}
+			delete(parents[oldName], oldName) // Recursive messages don't count as parents.
+			if len(parents[oldName]) != 1 {
+				continue
+			}
+			var parentName string
+			for name := range parents[oldName] {
+				parentName = name
+			}
+			parent := messages[parentName]
+			if parent == nil || strings.HasPrefix(parentName, oldName+".") || hasNestedType(parent, m.GetName()) {
+				continue
+			}
+
+			parent.NestedType = append(parent.NestedType, m)
+			removeMessage(descr, m)
+			newName := parentName + "." + m.GetName()
+			renameReferences(descr, oldName, newName)
+			renderer.nestedMessages[inlineMessages[oldName]] = newName
+			delete(inlineMessages, oldName)
+			nested = true
+			break
+		}
+		if !nested {
+			return
+		}
+	}
+}
+
+// collectMessages collects all messages of 'messages' (including nested messages) with their fully qualified name
+// inside of 'result'. For every referenced message 'parents' contains the names of the messages that use it. Fields of
+// map entries are considered to be fields of the message that contains the map.
+func collectMessages(messages []*dpb.DescriptorProto, scope string, result map[string]*dpb.DescriptorProto,
+	parents map[string]map[string]bool) {
+	for _, m := range messages {
+		name := scope + "." + m.GetName()
+		result[name] = m
+
+		fields := m.Field
+		for _, nested := range m.NestedType {
+			if nested.GetOptions().GetMapEntry() {
+				fields = append(fields, nested.Field...)
+			}
+		}
+		for _, f := range fields {
+			if f.GetType() != dpb.FieldDescriptorProto_TYPE_MESSAGE {
+				continue
+			}
+			typeName := strings.TrimPrefix(f.GetTypeName(), ".")
+			if _, ok := parents[typeName]; !ok {
+				parents[typeName] = make(map[string]bool)
+			}
+			parents[typeName][name] = true
+		}
+
+		nestedMessages := make([]*dpb.DescriptorProto, 0)
+		for _, nested := range m.NestedType {
+			if !nested.GetOptions().GetMapEntry() {
+				nestedMessages = append(nestedMessages, nested)
+			}
+		}
+		collectMessages(nestedMessages, name, result, parents)
+	}
+}
+
+// hasNestedType checks whether 'message' already contains a nested message or enum with the name 'name'.
+func hasNestedType(message *dpb.DescriptorProto, name string) bool {
+	for _, nested := range message.NestedType {
+		if nested.GetName() == name {
+			return true
+		}
+	}
+	for _, enum := range message.EnumType {
+		if enum.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// removeMessage removes the top-level message 'message' from 'descr'.
+func removeMessage(descr *dpb.FileDescriptorProto, message *dpb.DescriptorProto) {
+	messages := make([]*dpb.DescriptorProto, 0)
+	for _, m := range descr.MessageType {
+		if m != message {
+			messages = append(messages, m)
+		}
+	}
+	descr.MessageType = messages
+}
+
+// renameReferences rewrites all references to the message 'oldName' (and to the types nested inside of it) to 'newName'.
+func renameReferences(descr *dpb.FileDescriptorProto, oldName string, newName string) {
+	var rename func(messages []*dpb.DescriptorProto)
+	rename = func(messages []*dpb.DescriptorProto) {
+		for _, m := range messages {
+			for _, f := range m.Field {
+				typeName := f.GetTypeName()
+				if typeName == oldName || strings.HasPrefix(typeName, oldName+".") {
+					typeName = newName + strings.TrimPrefix(typeName, oldName)
+					f.TypeName = &typeName
+				}
+			}
+			rename(m.NestedType)
+		}
+	}
+	rename(descr.MessageType)
+}
+
 // buildEnumDescriptorProto builds the necessary descriptor to render a enum. (https://developers.google.com/protocol-buffers/docs/proto3#enum)
 func buildEnumDescriptorProto(f *surface_v1.Field) *dpb.EnumDescriptorProto {
-	enumDescriptor := &dpb.EnumDescriptorProto{Name: &f.NativeType}
+	enumName := f.NativeType
+	if f.Kind == surface_v1.FieldKind_MAP {
+		_, enumName = getMapKeyAndValueType(f.NativeType)
+	}
+	enumDescriptor := &dpb.EnumDescriptorProto{Name: &enumName}
 	for enumCtr, value := range f.EnumValues {
 		num := int32(enumCtr)
-		name := strings.ToUpper(value)
+		name := value // The names of the values have been set inside of language.go
 		valueDescriptor := &dpb.EnumValueDescriptorProto{
 			Name:   &name,
 			Number: &num,
@@ -311,39 +816,47 @@ func buildEnumDescriptorProto(f *surface_v1.Field) *dpb.EnumDescriptorProto {
 }
 
 // buildMapDescriptorProto builds the necessary descriptor to render a map. (https://developers.google.com/protocol-buffers/docs/proto3#maps)
-// A map is represented as nested message with two fields: 'key', 'value' and the Options set accordingly.
-func buildMapDescriptorProto(field *surface_v1.Field) *dpb.DescriptorProto {
+// A map is represented as nested message with two fields: 'key', 'value' and the Options set accordingly. 'parentName' is
+// the fully qualified name of the message which contains the map.
+func buildMapDescriptorProto(field *surface_v1.Field, parentName string, renderer *Renderer) *dpb.DescriptorProto {
 	isMapEntry := true
-	n := field.FieldName + "Entry"
+	n := toCamelCase(field.FieldName) + "Entry"
 
 	mapDP := &dpb.DescriptorProto{
 		Name:    &n,
-		Field:   buildKeyValueFields(field),
+		Field:   buildKeyValueFields(field, parentName, renderer),
 		Options: &dpb.MessageOptions{MapEntry: &isMapEntry},
 	}
 	return mapDP
 }
 
 // buildKeyValueFields builds the necessary 'key', 'value' fields for the map descriptor.
-func buildKeyValueFields(field *surface_v1.Field) []*dpb.FieldDescriptorProto {
+func buildKeyValueFields(field *surface_v1.Field, parentName string, renderer *Renderer) []*dpb.FieldDescriptorProto {
 	k, v := "key", "value"
 	var n1, n2 int32 = 1, 2
 	l := dpb.FieldDescriptorProto_LABEL_OPTIONAL
-	t := dpb.FieldDescriptorProto_TYPE_STRING
+	keyType, valueType := getMapKeyAndValueType(field.NativeType)
 	keyField := &dpb.FieldDescriptorProto{
 		Name:   &k,
 		Number: &n1,
 		Label:  &l,
-		Type:   &t,
+		Type:   getFieldDescriptorType(keyType, nil),
 	}
 
-	valueType := field.NativeType[11:] // This transforms a string like 'map[string]int32' to 'int32'. In other words: the type of the value from the map.
 	valueField := &dpb.FieldDescriptorProto{
-		Name:     &v,
-		Number:   &n2,
-		Label:    &l,
-		Type:     getFieldDescriptorType(valueType, field.EnumValues),
-		TypeName: getTypeNameForMapValueType(valueType),
+		Name:   &v,
+		Number: &n2,
+		Label:  &l,
+		Type:   getFieldDescriptorType(valueType, field.EnumValues),
+	}
+	switch *valueField.Type {
+	case dpb.FieldDescriptorProto_TYPE_ENUM:
+		// The enum is nested inside of the message which contains the map.
+		typeName := parentName + "." + valueType
+		valueField.TypeName = &typeName
+	case dpb.FieldDescriptorProto_TYPE_MESSAGE:
+		typeName := getMessageTypeName(valueType, renderer)
+		valueField.TypeName = &typeName
 	}
 	return []*dpb.FieldDescriptorProto{keyField, valueField}
 }
@@ -382,6 +895,12 @@ func isRequestParameter(t *surface_v1.Type) bool {
 	return false
 }
 
+// isParameterReference checks whether 'f' is a reference to a parameter component. gnostic names those fields after
+// the component instead of the parameter.
+func isParameterReference(t *surface_v1.Type, f *surface_v1.Field) bool {
+	return isRequestParameter(t) && f.Kind == surface_v1.FieldKind_REFERENCE && f.Name == f.Type
+}
+
 // setFieldDescriptorLabel sets a label for 'fd'. If it is an array we need the 'repeated' label.
 func setFieldDescriptorLabel(fd *dpb.FieldDescriptorProto, f *surface_v1.Field) {
 	label := dpb.FieldDescriptorProto_LABEL_OPTIONAL
@@ -391,18 +910,27 @@ func setFieldDescriptorLabel(fd *dpb.FieldDescriptorProto, f *surface_v1.Field)
 	fd.Label = &label
 }
 
+// setFieldDescriptorJsonName sets the JsonName of 'fd' to the name of the field inside of the API description, if
+// protocol buffers would derive a different JSON name from the field name (e.g.: 'photoURLs' becomes 'photo_urls' which
+// is transcoded as 'photoUrls'). That way gRPC-JSON transcoding keeps the original names. Fields which are introduced
+// by gnostic (request bodies, additional properties and media types) are not part of any JSON payload and are skipped.
+// Reference: https://developers.google.com/protocol-buffers/docs/proto3#json
+func setFieldDescriptorJsonName(fd *dpb.FieldDescriptorProto, f *surface_v1.Field) {
+	if f.Name == "request_body" || f.Name == "additional_properties" || strings.Contains(f.Name, "/") {
+		return
+	}
+	if f.Name != jsonName(f.FieldName) {
+		fd.JsonName = &f.Name
+	}
+}
+
 // setFieldDescriptorTypeName sets the TypeName of 'fd'. A TypeName has to be set if the field is a reference to another
 // message. Otherwise it is nil. Names are set according to the protocol buffer style guide for message names:
 // https://developers.google.com/protocol-buffers/docs/style#message-and-field-names
-func setFieldDescriptorTypeName(fd *dpb.FieldDescriptorProto, f *surface_v1.Field, packageName string) {
+func setFieldDescriptorTypeName(fd *dpb.FieldDescriptorProto, f *surface_v1.Field, renderer *Renderer) {
 	// A field with a type of Message always has a typeName associated with it (the name of the Message).
 	if *fd.Type == dpb.FieldDescriptorProto_TYPE_MESSAGE {
-		typeName := packageName + "." + f.NativeType
-
-		// Check whether we generated this message already inside of another dependency. If so we will use that name instead.
-		if n, ok := generatedMessages[f.NativeType]; ok {
-			typeName = n
-		}
+		typeName := getMessageTypeName(f.NativeType, renderer)
 		fd.TypeName = &typeName
 	}
 	if *fd.Type == dpb.FieldDescriptorProto_TYPE_ENUM {
@@ -410,16 +938,45 @@ func setFieldDescriptorTypeName(fd *dpb.FieldDescriptorProto, f *surface_v1.Fiel
 	}
 }
 
+// setSymbolicReferenceTypeName sets the TypeName of 'fd' to the fully qualified name of the referenced message, if the
+// field was built from the symbolic reference 'ref'. The message is qualified with the package of the .proto file that
+// has been generated for the referenced description.
+func setSymbolicReferenceTypeName(fd *dpb.FieldDescriptorProto, ref string) {
+	if ref == "" || fd.GetType() != dpb.FieldDescriptorProto_TYPE_MESSAGE {
+		return
+	}
+	location := strings.Split(ref, "#")[0]
+	packageName, ok := generatedSymbolicReferences[location]
+	if !ok {
+		return
+	}
+	messageName := protoTypeName(referenceName(ref))
+	if n, ok := renamedSymbolicMessages[location+"#"+messageName]; ok {
+		messageName = n
+	}
+	typeName := packageName + "." + messageName
+	fd.TypeName = &typeName
+}
+
 // getRequestBodyForRequestParameters finds the corresponding surface model type for 'name' and returns the name of the
-// field that is a request body. If no such field is found it returns nil.
+// field that is a request body. If the type is not a parameters type, the whole message is the request body and "*" is
+// returned. If no such field is found it returns nil.
 func getRequestBodyForRequestParameters(name string, types []*surface_v1.Type) *string {
-	requestParameterType := &surface_v1.Type{}
+	var requestParameterType *surface_v1.Type
 
 	for _, t := range types {
-		if t.Name == name {
+		if t.TypeName == name {
 			requestParameterType = t
 		}
 	}
+	if requestParameterType == nil {
+		return nil
+	}
+
+	if !isRequestParameter(requestParameterType) {
+		wildcard := "*"
+		return &wildcard
+	}
 
 	for _, f := range requestParameterType.Fields {
 		if f.Position == surface_v1.Position_BODY {
@@ -431,38 +988,28 @@ func getRequestBodyForRequestParameters(name string, types []*surface_v1.Type) *
 
 // getHttpRuleForMethod constructs a HttpRule from google/api/http.proto. Enables gRPC-HTTP transcoding on 'method'.
 // If not nil, body is also set.
-func getHttpRuleForMethod(method *surface_v1.Method, body *string) annotations.HttpRule {
-	var httpRule annotations.HttpRule
+func getHttpRuleForMethod(method *surface_v1.Method, body *string) *annotations.HttpRule {
+	httpRule := &annotations.HttpRule{}
 	switch method.Method {
 	case "GET":
-		httpRule = annotations.HttpRule{
-			Pattern: &annotations.HttpRule_Get{
-				Get: method.Path,
-			},
+		httpRule.Pattern = &annotations.HttpRule_Get{
+			Get: method.Path,
 		}
 	case "POST":
-		httpRule = annotations.HttpRule{
-			Pattern: &annotations.HttpRule_Post{
-				Post: method.Path,
-			},
+		httpRule.Pattern = &annotations.HttpRule_Post{
+			Post: method.Path,
 		}
 	case "PUT":
-		httpRule = annotations.HttpRule{
-			Pattern: &annotations.HttpRule_Put{
-				Put: method.Path,
-			},
+		httpRule.Pattern = &annotations.HttpRule_Put{
+			Put: method.Path,
 		}
 	case "PATCH":
-		httpRule = annotations.HttpRule{
-			Pattern: &annotations.HttpRule_Patch{
-				Patch: method.Path,
-			},
+		httpRule.Pattern = &annotations.HttpRule_Patch{
+			Patch: method.Path,
 		}
 	case "DELETE":
-		httpRule = annotations.HttpRule{
-			Pattern: &annotations.HttpRule_Delete{
-				Delete: method.Path,
-			},
+		httpRule.Pattern = &annotations.HttpRule_Delete{
+			Delete: method.Path,
 		}
 	}
 
@@ -473,14 +1020,29 @@ func getHttpRuleForMethod(method *surface_v1.Method, body *string) annotations.H
 	return httpRule
 }
 
-// getTypeNameForMapValueType returns the type name for the given 'valueType'.
-// A type name for a field is only set if it is some kind of reference (non-scalar values) otherwise it is nil.
-func getTypeNameForMapValueType(valueType string) *string {
-	if _, ok := protoBufScalarTypes[valueType]; ok {
-		return nil // Ok it is a scalar. For scalar values we don't set the TypeName of the field.
+// getMessageTypeName returns the fully qualified name of the message 'messageName'.
+func getMessageTypeName(messageName string, renderer *Renderer) string {
+	if strings.Contains(messageName, ".") {
+		return messageName // Already fully qualified (e.g.: google.protobuf.Struct).
+	}
+	if renderer.Model.TypeWithTypeName(messageName) != nil {
+		return renderer.Package + "." + messageName
 	}
-	typeName := valueType
-	return &typeName
+	// Check whether we generated this message already inside of another dependency. If so we will use that name instead.
+	if n, ok := renderer.nestedMessages[messageName]; ok {
+		return n
+	}
+	if n, ok := generatedMessages[messageName]; ok {
+		return n
+	}
+	return renderer.Package + "." + messageName
+}
+
+// getMapKeyAndValueType splits the native type of a map (e.g.: 'map[string]int32') into the type of the key and the
+// type of the value.
+func getMapKeyAndValueType(nativeType string) (keyType string, valueType string) {
+	end := strings.Index(nativeType, "]")
+	return nativeType[len("map["):end], nativeType[end+1:]
 }
 
 // getFieldDescriptorType returns a field descriptor type for the given 'nativeType'. If it is not a scalar type
@@ -497,15 +1059,32 @@ func getFieldDescriptorType(nativeType string, enumValues []string) *dpb.FieldDe
 	return &protoType
 }
 
+// parseOpenAPIDocument runs gnostic to parse the OpenAPI description at 'path' (a file path or URL).
+func parseOpenAPIDocument(path string) (*openapiv3.Document, error) {
+	cmd := exec.Command("gnostic", "--pb-out=-", path)
+	b, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return createOpenAPIDocFromGnosticOutput(b)
+}
+
 // createOpenAPIDocFromGnosticOutput uses the 'binaryInput' from gnostic to create a OpenAPI document.
 func createOpenAPIDocFromGnosticOutput(binaryInput []byte) (*openapiv3.Document, error) {
 	document := &openapiv3.Document{}
 	err := proto.Unmarshal(binaryInput, document)
-	if err != nil {
-		// If we execute gnostic with argument: '-pb-out=-' we get an EOF. So lets only return other errors.
-		if err.Error() != "unexpected EOF" {
-			return nil, err
-		}
+	if err == nil {
+		return document, nil
+	}
+	// Older versions of gnostic (github.com/googleapis/gnostic) append a newline to the binary output of '--pb-out=-'.
+	// It can't be trimmed in any case, since the encoding of a document may end with a newline as well.
+	trimmed := bytes.TrimSuffix(binaryInput, []byte("\n"))
+	if len(trimmed) == len(binaryInput) {
+		return nil, err
+	}
+	document = &openapiv3.Document{}
+	if err := proto.Unmarshal(trimmed, document); err != nil {
+		return nil, err
 	}
 	return document, nil
 }
@@ -561,13 +1140,16 @@ func getProtobufTypes() map[string]dpb.FieldDescriptorProto_Type {
 }
 
 // findValidServiceName finds a valid service name for the gRPC service. A valid service name is not already taken by a
-// message. Reference: https://github.com/googleapis/gnostic-grpc/issues/7
-func findValidServiceName(messages []*dpb.DescriptorProto, serviceName string) string {
+// message or another service. Reference: https://github.com/googleapis/gnostic-grpc/issues/7
+func findValidServiceName(descr *dpb.FileDescriptorProto, serviceName string) string {
 	messageNames := make(map[string]bool)
 
-	for _, m := range messages {
+	for _, m := range descr.MessageType {
 		messageNames[*m.Name] = true
 	}
+	for _, s := range descr.Service {
+		messageNames[*s.Name] = true
+	}
 
 	validServiceName := serviceName
 	ctr := 0
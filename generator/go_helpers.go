@@ -0,0 +1,314 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"errors"
+	"go/format"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	plugins "github.com/google/gnostic/plugins"
+	grpcannotations "github.com/googleapis/gnostic-grpc/annotations"
+	"google.golang.org/protobuf/proto"
+	dpb "google.golang.org/protobuf/types/descriptorpb"
+)
+
+// goSection is a part of the Go file that is rendered by renderGoHelpers together with the packages it imports.
+type goSection struct {
+	source  string
+	imports []string
+}
+
+// renderGoHelpers adds a Go file ('<name>_gnostic.go') to 'response', which helps gRPC servers that implement the
+// services of the rendered file to handle the options of annotations/annotations.proto (e.g.: a table of the security
+// requirements for interceptors). The Go package is the one of the option 'go_package' (see goPackageName), otherwise
+// it is named after the last segment of the package of the file. The file is omitted if none of the RPCs has such an
+// option.
+func (renderer *Renderer) renderGoHelpers(response *plugins.Response) error {
+	mainProto := getLast(renderer.FdSet.File)
+	sections := make([]goSection, 0)
+	for _, section := range []goSection{
+		securityRequirementsTable(mainProto),
+		requestMetadataHelpers(mainProto),
+		responseHeadersHelpers(mainProto),
+	} {
+		if section.source != "" {
+			sections = append(sections, section)
+		}
+	}
+	if len(sections) == 0 {
+		return nil
+	}
+
+	segments := strings.Split(mainProto.GetPackage(), ".")
+	packageName := segments[len(segments)-1]
+	if renderer.GoPackage != "" {
+		packageName = goPackageName(renderer.GoPackage)
+	}
+	source := &strings.Builder{}
+	source.WriteString("// Code generated by gnostic-grpc. DO NOT EDIT.\n")
+	source.WriteString("// source: " + mainProto.GetName() + "\n\n")
+	source.WriteString("package " + packageName + "\n\n")
+	imports := make([]string, 0)
+	for _, section := range sections {
+		for _, i := range section.imports {
+			if !isDuplicate(imports, i) {
+				imports = append(imports, i)
+			}
+		}
+	}
+	if len(imports) > 0 {
+		// The packages of the standard library are imported first, as goimports does.
+		sort.Slice(imports, func(i, j int) bool {
+			if isStandardPackage(imports[i]) != isStandardPackage(imports[j]) {
+				return isStandardPackage(imports[i])
+			}
+			return imports[i] < imports[j]
+		})
+		source.WriteString("import (\n")
+		for n, i := range imports {
+			if n > 0 && isStandardPackage(imports[n-1]) && !isStandardPackage(i) {
+				source.WriteString("\n")
+			}
+			source.WriteString(strconv.Quote(i) + "\n")
+		}
+		source.WriteString(")\n\n")
+	}
+	for _, section := range sections {
+		source.WriteString(section.source + "\n")
+	}
+
+	formatted, err := format.Source([]byte(source.String()))
+	if err != nil {
+		return errors.New("could not format the Go helpers of " + mainProto.GetName() + ": " + err.Error())
+	}
+	f := &plugins.File{
+		Name: strings.TrimSuffix(mainProto.GetName(), ".proto") + "_gnostic.go",
+		Data: formatted,
+	}
+	response.Files = append(response.Files, f)
+	return nil
+}
+
+// goPackageName returns the name of the Go package of the option 'go_package' 'goPackage' the same way protoc-gen-go
+// does: the name after a ';' (e.g.: 'example.com/pets/v1;pets'), otherwise the last segment of the import path, with
+// characters that are not allowed in identifiers replaced by '_'.
+func goPackageName(goPackage string) string {
+	if i := strings.LastIndex(goPackage, ";"); i >= 0 {
+		return goPackage[i+1:]
+	}
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, path.Base(goPackage))
+	if r, _ := utf8.DecodeRuneInString(name); unicode.IsDigit(r) || token.Lookup(name).IsKeyword() {
+		name = "_" + name
+	}
+	return name
+}
+
+// isStandardPackage checks whether the import path 'path' belongs to the standard library, whose paths don't start
+// with a domain.
+func isStandardPackage(path string) bool {
+	return !strings.Contains(strings.Split(path, "/")[0], ".")
+}
+
+// securityRequirementsTable returns the Go source of the variable 'SecurityRequirements', which maps the full names of
+// the RPCs of 'fd' to the security requirements of their options '(gnostic.grpc.security)'. The section is empty, if
+// none of the RPCs has security requirements.
+func securityRequirementsTable(fd *dpb.FileDescriptorProto) goSection {
+	entries := &strings.Builder{}
+	for _, s := range fd.Service {
+		for _, m := range s.Method {
+			security := proto.GetExtension(m.GetOptions(), grpcannotations.E_Security).([]*grpcannotations.SecurityRequirement)
+			if len(security) == 0 {
+				continue
+			}
+			entries.WriteString(strconv.Quote(fullMethodName(fd, s, m)) + ": {\n")
+			for _, requirement := range security {
+				schemes := make([]string, 0)
+				for _, scheme := range requirement.Schemes {
+					scopes := make([]string, 0)
+					for _, scope := range scheme.Scopes {
+						scopes = append(scopes, strconv.Quote(scope))
+					}
+					schemes = append(schemes, strconv.Quote(scheme.Name)+": {"+strings.Join(scopes, ", ")+"}")
+				}
+				entries.WriteString("{" + strings.Join(schemes, ", ") + "},\n")
+			}
+			entries.WriteString("},\n")
+		}
+	}
+	if entries.Len() == 0 {
+		return goSection{}
+	}
+	return goSection{source: `// SecurityRequirements maps the full names of the RPCs (see grpc.UnaryServerInfo) to the security requirements of
+// the operations they were built from. Every requirement maps the names of security schemes to the scopes they need.
+// A request has to satisfy one of the requirements. RPCs without security requirements are not listed.
+var SecurityRequirements = map[string][]map[string][]string{
+` + entries.String() + "}\n"}
+}
+
+// requestMetadataHelpers returns the Go source of the function 'MetadataParameters', which reads the header and cookie
+// parameters of the options '(gnostic.grpc.request_metadata)' of the RPCs of 'fd' from the metadata of a request. The
+// section is empty, if none of the RPCs has such parameters.
+func requestMetadataHelpers(fd *dpb.FileDescriptorProto) goSection {
+	entries := &strings.Builder{}
+	for _, s := range fd.Service {
+		for _, m := range s.Method {
+			parameters := proto.GetExtension(m.GetOptions(), grpcannotations.E_RequestMetadata).([]*grpcannotations.MetadataParameter)
+			if len(parameters) == 0 {
+				continue
+			}
+			entries.WriteString(strconv.Quote(fullMethodName(fd, s, m)) + ": {\n")
+			for _, parameter := range parameters {
+				entries.WriteString("{name: " + strconv.Quote(parameter.Name) + ", in: " + strconv.Quote(parameter.In) +
+					", key: " + strconv.Quote(parameter.Key) + ", required: " + strconv.FormatBool(parameter.Required) + "},\n")
+			}
+			entries.WriteString("},\n")
+		}
+	}
+	if entries.Len() == 0 {
+		return goSection{}
+	}
+	return goSection{
+		imports: []string{"google.golang.org/grpc/codes", "google.golang.org/grpc/metadata", "google.golang.org/grpc/status",
+			"net/http"},
+		source: `// metadataParameter is a header or cookie parameter of an operation.
+type metadataParameter struct {
+	name     string
+	in       string
+	key      string
+	required bool
+}
+
+// requestMetadata maps the full names of the RPCs to the header and cookie parameters of the operations they were built
+// from.
+var requestMetadata = map[string][]metadataParameter{
+` + entries.String() + `}
+
+// MetadataParameters returns the values of the header and cookie parameters of the RPC 'fullMethod' (see
+// grpc.UnaryServerInfo) by the names of the parameters. The values are read from the metadata 'md' of the request
+// (see metadata.FromIncomingContext). It returns an error with the code InvalidArgument, if a required parameter is
+// missing.
+func MetadataParameters(fullMethod string, md metadata.MD) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, parameter := range requestMetadata[fullMethod] {
+		value, ok := metadataValue(md, parameter)
+		if !ok {
+			if parameter.required {
+				return nil, status.Errorf(codes.InvalidArgument, "missing %s parameter %q", parameter.in, parameter.name)
+			}
+			continue
+		}
+		values[parameter.name] = value
+	}
+	return values, nil
+}
+
+// metadataValue returns the value of 'parameter' inside of 'md'. Cookies are parsed from the 'cookie' metadata.
+func metadataValue(md metadata.MD, parameter metadataParameter) (string, bool) {
+	values := md.Get(parameter.key)
+	if parameter.in == "cookie" {
+		request := &http.Request{Header: http.Header{"Cookie": values}}
+		cookie, err := request.Cookie(parameter.name)
+		if err != nil {
+			return "", false
+		}
+		return cookie.Value, true
+	}
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
+`,
+	}
+}
+
+// responseHeadersHelpers returns the Go source of the function 'SetResponseHeaders', which sends the headers of the
+// options '(gnostic.grpc.response_headers)' of the RPCs of 'fd' as header metadata of a response. The section is empty,
+// if none of the RPCs has response headers.
+func responseHeadersHelpers(fd *dpb.FileDescriptorProto) goSection {
+	entries := &strings.Builder{}
+	for _, s := range fd.Service {
+		for _, m := range s.Method {
+			headers := proto.GetExtension(m.GetOptions(), grpcannotations.E_ResponseHeaders).([]*grpcannotations.ResponseHeader)
+			// The same header can be documented for several responses.
+			names := make([]string, 0)
+			for _, header := range headers {
+				if !isDuplicate(names, strconv.Quote(header.Name)) {
+					names = append(names, strconv.Quote(header.Name))
+				}
+			}
+			if len(names) == 0 {
+				continue
+			}
+			entries.WriteString(strconv.Quote(fullMethodName(fd, s, m)) + ": {" + strings.Join(names, ", ") + "},\n")
+		}
+	}
+	if entries.Len() == 0 {
+		return goSection{}
+	}
+	return goSection{
+		imports: []string{"context", "strings", "google.golang.org/grpc", "google.golang.org/grpc/codes",
+			"google.golang.org/grpc/metadata", "google.golang.org/grpc/status"},
+		source: `// responseHeaders maps the full names of the RPCs to the names of the headers of the responses of the operations they
+// were built from.
+var responseHeaders = map[string][]string{
+` + entries.String() + `}
+
+// SetResponseHeaders sends 'values' (by the names of the headers) as header metadata of the response of the RPC
+// 'fullMethod' (see grpc.UnaryServerInfo), so that gRPC-JSON transcoding returns them as HTTP headers. It has to be
+// called before the response is sent (see grpc.SetHeader). It returns an error with the code Internal, if one of the
+// headers is not documented for the RPC.
+func SetResponseHeaders(ctx context.Context, fullMethod string, values map[string]string) error {
+	pairs := make([]string, 0, 2*len(values))
+	for name, value := range values {
+		if !isResponseHeader(fullMethod, name) {
+			return status.Errorf(codes.Internal, "undocumented response header %q", name)
+		}
+		pairs = append(pairs, strings.ToLower(name), value)
+	}
+	return grpc.SetHeader(ctx, metadata.Pairs(pairs...))
+}
+
+// isResponseHeader checks whether 'name' is a header of the responses of the RPC 'fullMethod'. Header names are case
+// insensitive.
+func isResponseHeader(fullMethod string, name string) bool {
+	for _, header := range responseHeaders[fullMethod] {
+		if strings.EqualFold(header, name) {
+			return true
+		}
+	}
+	return false
+}
+`,
+	}
+}
+
+// fullMethodName returns the name gRPC uses for the RPC 'm' of the service 's' of 'fd' (e.g.:
+// '/bookstore.Bookstore/GetShelf').
+func fullMethodName(fd *dpb.FileDescriptorProto, s *dpb.ServiceDescriptorProto, m *dpb.MethodDescriptorProto) string {
+	return "/" + fd.GetPackage() + "." + s.GetName() + "/" + m.GetName()
+}
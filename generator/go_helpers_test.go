@@ -0,0 +1,153 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	plugins "github.com/google/gnostic/plugins"
+)
+
+// The tests that are run against the Go helpers of headers.yaml.
+const metadataParametersTest = `package headers
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestMetadataParameters(t *testing.T) {
+	md := metadata.Pairs("x-request-id", "42", "cookie", "theme=dark; session=abc")
+	values, err := MetadataParameters("/headers.Headers/ListPets", md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["X-Request-ID"] != "42" || values["session"] != "abc" {
+		t.Errorf("unexpected values: %v", values)
+	}
+	if _, ok := values["Accept-Language"]; ok {
+		t.Errorf("the missing optional parameter Accept-Language has a value: %v", values)
+	}
+
+	_, err = MetadataParameters("/headers.Headers/DeletePet", metadata.Pairs("x-request-id", "42"))
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for the missing header If-Match, got %v", err)
+	}
+}
+`
+
+// The tests that are run against the Go helpers of responseHeaders.yaml.
+const setResponseHeadersTest = `package responseheaders
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// stream collects the headers that are set by a RPC.
+type stream struct {
+	header metadata.MD
+}
+
+func (s *stream) Method() string                  { return "/responseheaders.Responseheaders/GetPet" }
+func (s *stream) SetHeader(md metadata.MD) error  { s.header = metadata.Join(s.header, md); return nil }
+func (s *stream) SendHeader(md metadata.MD) error { return nil }
+func (s *stream) SetTrailer(md metadata.MD) error { return nil }
+
+func TestSetResponseHeaders(t *testing.T) {
+	s := &stream{}
+	ctx := grpc.NewContextWithServerTransportStream(context.Background(), s)
+	err := SetResponseHeaders(ctx, s.Method(), map[string]string{"ETag": "v1", "retry-after": "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.header.Get("etag")) != 1 || s.header.Get("etag")[0] != "v1" || s.header.Get("retry-after")[0] != "10" {
+		t.Errorf("unexpected headers: %v", s.header)
+	}
+
+	err = SetResponseHeaders(ctx, s.Method(), map[string]string{"X-RateLimit-Remaining": "5"})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("expected Internal for the undocumented header X-RateLimit-Remaining, got %v", err)
+	}
+}
+`
+
+func TestGoHelpers(t *testing.T) {
+	goCommand, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("the go command is needed to build the Go helpers")
+	}
+	// The packages have to be inside of the module to use its dependencies. Directories starting with '_' are ignored
+	// by patterns like './...'.
+	dir, err := ioutil.TempDir(".", "_gohelpers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	packages := []string{}
+	for _, helpers := range []struct {
+		input       string
+		packageName string
+		test        string
+	}{
+		{"testfiles/headers.yaml", "headers", metadataParametersTest},
+		{"testfiles/responseHeaders.yaml", "responseheaders", setResponseHeadersTest},
+	} {
+		r, err := prepareRenderer(helpers.input, helpers.packageName, map[string]string{"grpc_annotations": "true"})
+		if err != nil {
+			handleError(err, t)
+			return
+		}
+		response := &plugins.Response{}
+		if err := r.Render(response, helpers.packageName+".proto"); err != nil {
+			handleError(err, t)
+			return
+		}
+		packageDir := filepath.Join(dir, helpers.packageName)
+		if err := os.Mkdir(packageDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		files := map[string]string{helpers.packageName + "_test.go": helpers.test}
+		for _, f := range response.Files {
+			if filepath.Ext(f.Name) == ".go" {
+				files[f.Name] = string(f.Data)
+			}
+		}
+		for name, data := range files {
+			if err := ioutil.WriteFile(filepath.Join(packageDir, name), []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		packages = append(packages, "./"+filepath.ToSlash(packageDir))
+	}
+
+	output, err := exec.Command(goCommand, append([]string{"test", "-count=1"}, packages...)...).CombinedOutput()
+	if err != nil {
+		t.Errorf("The Go helpers don't work as expected: %s\n%s", err, output)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"strings"
+
+	openapiv3 "github.com/google/gnostic/openapiv3"
+	surface_v1 "github.com/google/gnostic/surface"
+	grpcannotations "github.com/googleapis/gnostic-grpc/annotations"
+	"google.golang.org/protobuf/proto"
+	dpb "google.golang.org/protobuf/types/descriptorpb"
+)
+
+// The fields of OpenAPI elements that are rendered as options of annotations/annotations.proto. The checker doesn't
+// report them if the options are rendered.
+var (
+	grpcAnnotatedDocumentFields   = []string{"security"}
+	grpcAnnotatedComponentsFields = []string{"securitySchemes", "headers"}
+	grpcAnnotatedOperationFields  = []string{"security"}
+	grpcAnnotatedParameterFields  = []string{"required"}
+	grpcAnnotatedResponseFields   = []string{"headers"}
+)
+
+// setSecurityAnnotation sets the option '(gnostic.grpc.security)' of 'md' to the security requirements of 'operation'.
+// Operations without security requirements of their own inherit the requirements of 'document'.
+func setSecurityAnnotation(md *dpb.MethodDescriptorProto, operation *openapiv3.Operation, document *openapiv3.Document) {
+	requirements := operation.GetSecurity()
+	if requirements == nil {
+		requirements = document.GetSecurity()
+	}
+	security := make([]*grpcannotations.SecurityRequirement, 0)
+	for _, requirement := range requirements {
+		schemes := make([]*grpcannotations.RequiredScheme, 0)
+		for _, pair := range requirement.GetAdditionalProperties() {
+			schemes = append(schemes, &grpcannotations.RequiredScheme{
+				Name:   pair.Name,
+				Type:   findSecuritySchemeType(document, pair.Name),
+				Scopes: pair.Value.GetValue(),
+			})
+		}
+		security = append(security, &grpcannotations.SecurityRequirement{Schemes: schemes})
+	}
+	if len(security) == 0 {
+		return
+	}
+	if md.Options == nil {
+		md.Options = &dpb.MethodOptions{}
+	}
+	proto.SetExtension(md.Options, grpcannotations.E_Security, security)
+}
+
+// setResponseHeadersAnnotation sets the option '(gnostic.grpc.response_headers)' of 'md' to the headers of the responses
+// of 'operation'. References to responses and headers are resolved with the components of 'document'.
+func setResponseHeadersAnnotation(md *dpb.MethodDescriptorProto, operation *openapiv3.Operation,
+	document *openapiv3.Document) {
+	// The responses are copied, so that the default response isn't appended to the ones of 'operation'.
+	responses := append([]*openapiv3.NamedResponseOrReference{}, operation.GetResponses().GetResponseOrReference()...)
+	if defaultResponse := operation.GetResponses().GetDefault(); defaultResponse != nil {
+		responses = append(responses, &openapiv3.NamedResponseOrReference{Name: "default", Value: defaultResponse})
+	}
+	headers := make([]*grpcannotations.ResponseHeader, 0)
+	for _, pair := range responses {
+		response := pair.Value.GetResponse()
+		if reference := pair.Value.GetReference(); reference != nil {
+			response = findResponse(document, reference.XRef)
+		}
+		for _, namedHeader := range response.GetHeaders().GetAdditionalProperties() {
+			header := namedHeader.Value.GetHeader()
+			if reference := namedHeader.Value.GetReference(); reference != nil {
+				header = findHeader(document, reference.XRef)
+			}
+			if header == nil {
+				continue
+			}
+			headers = append(headers, &grpcannotations.ResponseHeader{
+				Name:        namedHeader.Name,
+				Key:         strings.ToLower(namedHeader.Name),
+				Status:      pair.Name,
+				Required:    header.Required,
+				Description: header.Description,
+			})
+		}
+	}
+	if len(headers) == 0 {
+		return
+	}
+	if md.Options == nil {
+		md.Options = &dpb.MethodOptions{}
+	}
+	proto.SetExtension(md.Options, grpcannotations.E_ResponseHeaders, headers)
+}
+
+// findResponse returns the response component of 'document' that 'reference' points to (e.g.:
+// '#/components/responses/NotFound') or nil.
+func findResponse(document *openapiv3.Document, reference string) *openapiv3.Response {
+	if !strings.HasPrefix(reference, "#/components/responses/") {
+		return nil
+	}
+	for _, pair := range document.GetComponents().GetResponses().GetAdditionalProperties() {
+		if pair.Name == referenceName(reference) {
+			return pair.Value.GetResponse()
+		}
+	}
+	return nil
+}
+
+// findHeader returns the header component of 'document' that 'reference' points to (e.g.:
+// '#/components/headers/ETag') or nil.
+func findHeader(document *openapiv3.Document, reference string) *openapiv3.Header {
+	if !strings.HasPrefix(reference, "#/components/headers/") {
+		return nil
+	}
+	for _, pair := range document.GetComponents().GetHeaders().GetAdditionalProperties() {
+		if pair.Name == referenceName(reference) {
+			return pair.Value.GetHeader()
+		}
+	}
+	return nil
+}
+
+// findSecuritySchemeType returns the type of the security scheme 'name' of 'document' (e.g.: 'oauth2') or an empty
+// string.
+func findSecuritySchemeType(document *openapiv3.Document, name string) string {
+	for _, pair := range document.GetComponents().GetSecuritySchemes().GetAdditionalProperties() {
+		if pair.Name == name {
+			return pair.Value.GetSecurityScheme().GetType()
+		}
+	}
+	return ""
+}
+
+// isMetadataParameter checks whether 'in' is the location of a parameter that gRPC carries as metadata.
+func isMetadataParameter(in string) bool {
+	return in == "header" || in == "cookie"
+}
+
+// metadataKey returns the metadata key that carries the header or cookie parameter 'parameter'. gRPC only allows
+// lowercase keys and transcoding passes all cookies inside of a single 'cookie' header.
+func metadataKey(parameter *openapiv3.Parameter) string {
+	if parameter.In == "cookie" {
+		return "cookie"
+	}
+	return strings.ToLower(parameter.Name)
+}
+
+// removeMetadataParameters removes the fields of header and cookie parameters from the parameters types of 'model',
+// since they are carried as metadata (see setMetadataAnnotation). The types of header and cookie parameter components
+// are removed as well. gnostic has no position for cookies, therefore the parameters are looked up in 'index'.
+func removeMetadataParameters(model *surface_v1.Model, index *schemaIndex) {
+	types := make([]*surface_v1.Type, 0)
+	for _, t := range model.Types {
+		if isMetadataParameterComponent(t, index) {
+			continue
+		}
+		types = append(types, t)
+		if !isRequestParameter(t) {
+			continue
+		}
+		fields := make([]*surface_v1.Field, 0)
+		for _, f := range t.Fields {
+			if f.Position == surface_v1.Position_HEADER || isMetadataParameter(index.lookupParameter(t.Name, f.Name).GetIn()) {
+				continue
+			}
+			fields = append(fields, f)
+		}
+		t.Fields = fields
+	}
+	model.Types = types
+}
+
+// isMetadataParameterComponent checks whether 't' was built from a header or cookie parameter component. gnostic
+// builds a type with a single field for every parameter component.
+func isMetadataParameterComponent(t *surface_v1.Type, index *schemaIndex) bool {
+	if !index.isComponent(t.Name) || len(t.Fields) != 1 {
+		return false
+	}
+	return isMetadataParameter(index.lookupParameter(t.Name, t.Fields[0].Name).GetIn())
+}
+
+// setMetadataAnnotation sets the option '(gnostic.grpc.request_metadata)' of 'md' to the header and cookie parameters
+// of 'operation'. References are resolved with the parameter components of 'document'.
+func setMetadataAnnotation(md *dpb.MethodDescriptorProto, operation *openapiv3.Operation, document *openapiv3.Document) {
+	metadata := make([]*grpcannotations.MetadataParameter, 0)
+	for _, paramOrRef := range operation.GetParameters() {
+		parameter := paramOrRef.GetParameter()
+		if reference := paramOrRef.GetReference(); reference != nil {
+			parameter = findParameter(document, reference.XRef)
+		}
+		if parameter == nil || !isMetadataParameter(parameter.In) {
+			continue
+		}
+		metadata = append(metadata, &grpcannotations.MetadataParameter{
+			Name:        parameter.Name,
+			In:          parameter.In,
+			Key:         metadataKey(parameter),
+			Required:    parameter.Required,
+			Description: parameter.Description,
+		})
+	}
+	if len(metadata) == 0 {
+		return
+	}
+	if md.Options == nil {
+		md.Options = &dpb.MethodOptions{}
+	}
+	proto.SetExtension(md.Options, grpcannotations.E_RequestMetadata, metadata)
+}
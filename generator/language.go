@@ -18,13 +18,28 @@ import (
 	"strconv"
 	"strings"
 
-	surface_v1 "github.com/googleapis/gnostic/surface"
+	openapiv3 "github.com/google/gnostic/openapiv3"
+	plugins "github.com/google/gnostic/plugins"
+	surface_v1 "github.com/google/gnostic/surface"
 )
 
-type ProtoLanguageModel struct{}
+type ProtoLanguageModel struct {
+	// The OpenAPI v3 document the surface model was built from. It is optional and used to recover information that
+	// is not contained inside the surface model (e.g.: nested arrays).
+	Document *openapiv3.Document
+	// Decides on the names of RPCs and their request and response messages.
+	NamingStrategy NamingStrategy
+	// The messages that are displayed to the user with information of how the surface model has been adjusted.
+	messages []*plugins.Message
+}
 
 func NewProtoLanguageModel() *ProtoLanguageModel {
-	return &ProtoLanguageModel{}
+	return &ProtoLanguageModel{NamingStrategy: LegacyNamingStrategy{}, messages: make([]*plugins.Message, 0)}
+}
+
+// Messages returns the messages that were collected while preparing the surface model.
+func (language *ProtoLanguageModel) Messages() []*plugins.Message {
+	return language.messages
 }
 
 // Prepare sets language-specific properties for all types and methods.
@@ -39,19 +54,218 @@ func (language *ProtoLanguageModel) Prepare(model *surface_v1.Model, inputDocume
 
 			if f.EnumValues != nil {
 				f.NativeType = strings.Title(f.Name)
+				if f.Kind == surface_v1.FieldKind_MAP {
+					// The values of the map are enums.
+					f.NativeType = "map[string]" + protoTypeName(f.Name) + "Value"
+				}
 			}
 		}
 	}
 
+	typeNames := language.resolveNameCollisions(model)
+
 	for _, m := range model.Methods {
-		m.HandlerName = protoTypeName(m.Name)
+		m.HandlerName = language.NamingStrategy.RPCName(m)
 		m.ProcessorName = m.Name
 		m.ClientName = m.Name
-		m.ParametersTypeName = protoTypeName(m.ParametersTypeName)
-		m.ResponsesTypeName = protoTypeName(m.ResponsesTypeName)
+		m.ParametersTypeName = findTypeName(m.ParametersTypeName, typeNames)
+		m.ResponsesTypeName = findTypeName(m.ResponsesTypeName, typeNames)
 	}
+	language.resolveMethodNameCollisions(model)
 
-	AdjustSurfaceModel(model, inputDocumentType)
+	language.messages = append(language.messages, AdjustSurfaceModel(model, inputDocumentType)...)
+	language.applyNamingStrategy(model)
+	index := newSchemaIndex(language.Document)
+	buildListTypes(model, index)
+	adjustFreeFormTypes(model, index)
+	language.adjustMapKeys(model, index)
+}
+
+// adjustFreeFormTypes replaces types without any fields (free-form objects, e.g.: 'additionalProperties: true' or
+// 'additionalProperties: {}') with the well-known types of google/protobuf/struct.proto:
+//   - A free-form object becomes google.protobuf.Struct
+//   - A schema without a type becomes google.protobuf.Value
+//   - An array of schemas without a type becomes google.protobuf.ListValue
+//
+// The replaced types are removed from the surface model.
+func adjustFreeFormTypes(model *surface_v1.Model, index *schemaIndex) {
+	freeFormTypes := make(map[string]bool)
+	typesToDelete := make(map[*surface_v1.Type]bool)
+	for _, t := range model.Types {
+		isFreeForm := len(t.Fields) == 0 && t.Kind == surface_v1.TypeKind_OBJECT ||
+			hasUntypedAdditionalProperties(index.lookupType(t.Name))
+		freeFormTypes[t.TypeName] = isFreeForm
+		typesToDelete[t] = isFreeForm
+	}
+
+	for _, t := range model.Types {
+		for _, f := range t.Fields {
+			if f.Kind == surface_v1.FieldKind_MAP {
+				keyType, valueType := getMapKeyAndValueType(f.NativeType)
+				if freeFormTypes[valueType] {
+					f.NativeType = "map[" + keyType + "]" + findWellKnownType(index.lookup(t.Name, f.Name))
+				}
+				continue
+			}
+			if !freeFormTypes[f.NativeType] {
+				continue
+			}
+
+			schema := index.lookup(t.Name, f.Name)
+			if f.Kind == surface_v1.FieldKind_ARRAY {
+				if items := schema.GetItems().GetSchemaOrReference(); len(items) > 0 && isUntypedSchema(items[0].GetSchema()) {
+					// The whole array is represented by a single ListValue.
+					f.Kind = surface_v1.FieldKind_REFERENCE
+					f.NativeType = "google.protobuf.ListValue"
+					continue
+				}
+				f.NativeType = "google.protobuf.Struct"
+				continue
+			}
+			f.NativeType = findWellKnownType(schema)
+		}
+	}
+
+	for _, m := range model.Methods {
+		if freeFormTypes[m.ParametersTypeName] {
+			m.ParametersTypeName = "google.protobuf.Struct"
+		}
+		if freeFormTypes[m.ResponsesTypeName] {
+			m.ResponsesTypeName = "google.protobuf.Struct"
+		}
+	}
+	removeTypes(model, typesToDelete)
+}
+
+// findWellKnownType returns google.protobuf.Value for schemas without a type. For everything else (or if the schema is
+// unknown) google.protobuf.Struct is returned.
+func findWellKnownType(schema *openapiv3.Schema) string {
+	if isUntypedSchema(schema) {
+		return "google.protobuf.Value"
+	}
+	return "google.protobuf.Struct"
+}
+
+// hasUntypedAdditionalProperties checks whether 'schema' is an object without properties whose additional properties
+// accept any value ('additionalProperties: {}'), which is the same as 'additionalProperties: true'.
+func hasUntypedAdditionalProperties(schema *openapiv3.Schema) bool {
+	if schema == nil || len(schema.GetProperties().GetAdditionalProperties()) > 0 {
+		return false
+	}
+	return isUntypedSchema(schema.GetAdditionalProperties().GetSchemaOrReference().GetSchema())
+}
+
+// isUntypedSchema checks whether 'schema' accepts any value (e.g.: '{}').
+func isUntypedSchema(schema *openapiv3.Schema) bool {
+	return schema != nil && schema.Type == "" && schema.Properties == nil && schema.AdditionalProperties == nil &&
+		schema.AllOf == nil && schema.AnyOf == nil && schema.OneOf == nil
+}
+
+// adjustMapKeys sets the key type of maps to the type defined by the 'x-proto-map-key' specification extension of the
+// object schema. By default keys of maps are strings.
+func (language *ProtoLanguageModel) adjustMapKeys(model *surface_v1.Model, index *schemaIndex) {
+	for _, t := range model.Types {
+		schema := index.lookupType(t.Name)
+		if schema == nil {
+			continue
+		}
+		keyType := getSpecificationExtension(schema, "x-proto-map-key")
+		if keyType == "" {
+			continue
+		}
+
+		for _, f := range t.Fields {
+			if f.Kind != surface_v1.FieldKind_MAP {
+				continue
+			}
+			if !isValidMapKeyType(keyType) {
+				text := "The type '" + keyType + "' of 'x-proto-map-key' is not a valid key type for a map. Keys of the " +
+					"map '" + f.FieldName + "' are generated as string. " +
+					"See: https://developers.google.com/protocol-buffers/docs/proto3#maps for more information."
+				keys := append(copyKeys(index.lookupKeys(t.Name, "")), "x-proto-map-key")
+				msg := constructWarningMessage("MAPKEY", text, keys)
+				language.messages = append(language.messages, &msg)
+				continue
+			}
+			_, valueType := getMapKeyAndValueType(f.NativeType)
+			f.NativeType = "map[" + keyType + "]" + valueType
+		}
+	}
+}
+
+// isValidMapKeyType checks whether 'keyType' can be used as key type of a map. Any integral or string type is valid.
+func isValidMapKeyType(keyType string) bool {
+	switch keyType {
+	case "int32", "int64", "uint32", "uint64", "sint32", "sint64",
+		"fixed32", "fixed64", "sfixed32", "sfixed64", "bool", "string":
+		return true
+	}
+	return false
+}
+
+// buildListTypes adds wrapper messages to the surface model for nested arrays and for maps with array values, since
+// neither is supported by protocol buffers. E.g.: an array of arrays of strings becomes 'repeated StringList' and a
+// map with arrays of strings as values becomes 'map<string, StringList>', where StringList is a message with a single
+// field: 'repeated string values'.
+func buildListTypes(model *surface_v1.Model, index *schemaIndex) {
+	listTypes := make(map[string]*surface_v1.Type)
+	for _, t := range model.Types {
+		for _, f := range t.Fields {
+			if f.EnumValues != nil {
+				continue // Enums are nested inside of the parent message and can't be wrapped.
+			}
+			depth := arrayDepth(index.lookup(t.Name, f.Name))
+
+			if f.Kind == surface_v1.FieldKind_MAP && strings.HasPrefix(f.NativeType, "map[string][]") {
+				valueType := strings.TrimPrefix(f.NativeType, "map[string][]")
+				if depth < 1 {
+					depth = 1
+				}
+				f.NativeType = "map[string]" + findListType(model, listTypes, valueType, depth)
+			}
+			if f.Kind == surface_v1.FieldKind_ARRAY && depth > 1 {
+				f.NativeType = findListType(model, listTypes, f.NativeType, depth-1)
+			}
+		}
+	}
+}
+
+// findListType returns the name of the wrapper message for 'depth' nested lists of 'elementType'. Wrapper messages
+// that don't exist yet are added to the surface model.
+func findListType(model *surface_v1.Model, listTypes map[string]*surface_v1.Type, elementType string, depth int) string {
+	for i := 0; i < depth; i++ {
+		name := protoTypeName(elementType) + "List"
+		if _, ok := listTypes[name]; !ok && model.TypeWithTypeName(name) != nil {
+			name += "Wrapper" // There already is a message with that name inside the API description.
+		}
+		if _, ok := listTypes[name]; !ok {
+			listType := &surface_v1.Type{
+				Name:        name,
+				TypeName:    name,
+				Kind:        surface_v1.TypeKind_STRUCT,
+				Description: name + " is a list of " + elementType + " values.",
+				Fields: []*surface_v1.Field{{
+					Name:       "values",
+					FieldName:  "values",
+					Type:       elementType,
+					Kind:       surface_v1.FieldKind_ARRAY,
+					NativeType: elementType,
+				}},
+			}
+			listTypes[name] = listType
+			model.Types = append(model.Types, listType)
+		}
+		elementType = name
+	}
+	return elementType
+}
+
+// findTypeName returns the name of the proto message for the type with the name 'originalName'.
+func findTypeName(originalName string, typeNames map[string]string) string {
+	if name, ok := typeNames[originalName]; ok {
+		return name
+	}
+	return protoTypeName(originalName)
 }
 
 // findNativeType maps OpenAPI data types (https://swagger.io/docs/specification/data-models/data-types/)
@@ -106,57 +320,43 @@ func findNativeType(fType string, fFormat string) string {
 		return "string"
 	default:
 		if strings.Contains(fType, "map") {
-			mapType := fType[11:]
-			formattedType := map[string]bool{
-				"int32": true,
-				"int64": true,
+			prefix, mapType := "map[string]", fType[11:]
+			if strings.HasPrefix(mapType, "[]") {
+				// The values of the map are arrays.
+				prefix, mapType = prefix+"[]", mapType[2:]
 			}
-			if !formattedType[mapType] {
-				return "map[string]" + findNativeType(mapType, "")
+			if _, isScalar := protoBufScalarTypes[mapType]; !isScalar {
+				return prefix + findNativeType(mapType, "")
 			}
-			return fType
+			return prefix + mapType
 		}
 		return protoTypeName(fType)
 	}
 }
 
 // AdjustSurfaceModel simplifies and prettifies the types and fields of the surface model in order to get a better
-// looking output file.
+// looking output file. The returned messages describe which types have been collapsed.
 // Related to: https://github.com/googleapis/gnostic-grpc/issues/11
-func AdjustSurfaceModel(model *surface_v1.Model, inputDocumentType string) {
+func AdjustSurfaceModel(model *surface_v1.Model, inputDocumentType string) []*plugins.Message {
 	if inputDocumentType == "openapi.v2.Document" {
-		adjustV2Model(model)
+		return adjustV2Model(model)
 	} else if inputDocumentType == "openapi.v3.Document" {
-		adjustV3Model(model)
+		return adjustV3Model(model)
 	} else if inputDocumentType == "discovery.v1.Document" {
 		// TODO: We handle discovery format the same way like we handle v3 input files (which is probably wrong?).
 		// Either fix this if someone complains or throw a warning in checker.go, since according to the README.md
 		// gnnostic-grpc handles v3 schemas only. However, if other plugins also depend on this function this should be fixed!
-		adjustV3Model(model)
+		return adjustV3Model(model)
 	}
-
+	return nil
 }
 
-// adjustV3Model removes unnecessary types from the surface model. The original input file is an OpenAPI v2 file.
-func adjustV3Model(model *surface_v1.Model) {
+// adjustV3Model removes unnecessary types from the surface model. The original input file is an OpenAPI v3 file.
+func adjustV3Model(model *surface_v1.Model) []*plugins.Message {
 	nameToType, typesToDelete := initHashTables(model)
-	for _, m := range model.Methods {
-		if len(m.ParametersTypeName) > 0 {
-			if parameters, ok := nameToType[m.ParametersTypeName]; ok {
-				// For requestBodies we remove the intermediate type.
-				for _, f := range parameters.Fields {
-					if f.Name == "request_body" {
-						reqBody := f
-						if intermediateType, ok := nameToType[reqBody.NativeType]; ok {
-							reqBody.FieldName = intermediateType.Fields[0].FieldName
-							reqBody.NativeType = intermediateType.Fields[0].NativeType
-							typesToDelete[intermediateType] = true
-						}
-					}
-				}
-			}
-		}
+	messages := normalizeRequestBodies(model, nameToType, typesToDelete, isV3RequestBody)
 
+	for _, m := range model.Methods {
 		// We only render messages and types for the response with the lowest status code.
 		if len(m.ResponsesTypeName) > 0 {
 			if responses, ok := nameToType[m.ResponsesTypeName]; ok {
@@ -185,19 +385,15 @@ func adjustV3Model(model *surface_v1.Model) {
 		}
 	}
 
-	// Remove types that we don't want to render
-	filteredTypes := make([]*surface_v1.Type, 0)
-	for _, t := range model.Types {
-		if shouldDelete, ok := typesToDelete[t]; ok && !shouldDelete {
-			filteredTypes = append(filteredTypes, t)
-		}
-	}
-	model.Types = filteredTypes
+	removeTypes(model, typesToDelete)
+	return messages
 }
 
 // adjustV2Model removes types from the surface model. The original input file is an OpenAPI v2 file.
-func adjustV2Model(model *surface_v1.Model) {
+func adjustV2Model(model *surface_v1.Model) []*plugins.Message {
 	nameToType, typesToDelete := initHashTables(model)
+	messages := normalizeRequestBodies(model, nameToType, typesToDelete, isV2RequestBody)
+
 	for _, m := range model.Methods {
 		// We only render messages and types for the response with the lowest status code.
 		if len(m.ResponsesTypeName) > 0 {
@@ -221,7 +417,95 @@ func adjustV2Model(model *surface_v1.Model) {
 		}
 	}
 
-	// Remove types that we don't want to render
+	removeTypes(model, typesToDelete)
+	return messages
+}
+
+// normalizeRequestBodies is the part of the adjustment that is shared between OpenAPI v2 and v3 descriptions. For every
+// method it:
+//  1. Collapses wrapper messages of the request body. A wrapper message is a type which only holds the same
+//     schema for one or more media types (e.g.: 'application/json' and 'application/xml').
+//  2. Uses the request body type directly as input of the RPC, if the request body is the only parameter.
+//
+// 'isRequestBody' decides which field of the parameters type is the request body.
+func normalizeRequestBodies(model *surface_v1.Model, nameToType map[string]*surface_v1.Type,
+	typesToDelete map[*surface_v1.Type]bool, isRequestBody func(*surface_v1.Field) bool) []*plugins.Message {
+	messages := make([]*plugins.Message, 0)
+	for _, m := range model.Methods {
+		parameters, ok := nameToType[m.ParametersTypeName]
+		if !ok {
+			continue
+		}
+
+		for _, f := range parameters.Fields {
+			if !isRequestBody(f) {
+				continue
+			}
+			if wrapper, ok := nameToType[f.NativeType]; ok && isWrapperType(wrapper) {
+				// All fields of the wrapper hold the same schema, so only one of them is kept.
+				wrapper.Fields = wrapper.Fields[:1]
+				f.FieldName = wrapper.Fields[0].FieldName
+				f.NativeType = wrapper.Fields[0].NativeType
+				f.Kind = wrapper.Fields[0].Kind
+				f.EnumValues = wrapper.Fields[0].EnumValues
+				typesToDelete[wrapper] = true
+
+				text := "Collapsed wrapper message '" + wrapper.TypeName + "' into field '" + f.FieldName +
+					"' of message '" + parameters.TypeName + "'"
+				msg := constructInfoMessage("NORMALIZATION", text, []string{wrapper.TypeName})
+				messages = append(messages, &msg)
+			}
+		}
+
+		if len(parameters.Fields) != 1 {
+			continue
+		}
+		body := parameters.Fields[0]
+		if !isRequestBody(body) || body.Kind != surface_v1.FieldKind_REFERENCE {
+			continue
+		}
+		if bodyType, ok := nameToType[body.NativeType]; ok && !typesToDelete[bodyType] {
+			m.ParametersTypeName = bodyType.TypeName
+			typesToDelete[parameters] = true
+
+			text := "Collapsed message '" + parameters.TypeName + "': the request body '" + bodyType.TypeName +
+				"' is used as input for the RPC '" + m.HandlerName + "'"
+			msg := constructInfoMessage("NORMALIZATION", text, []string{parameters.TypeName})
+			messages = append(messages, &msg)
+		}
+	}
+	return messages
+}
+
+// isWrapperType checks whether 't' only wraps a single schema for one or more media types.
+func isWrapperType(t *surface_v1.Type) bool {
+	if len(t.Fields) == 0 {
+		return false
+	}
+	first := t.Fields[0]
+	for _, f := range t.Fields {
+		if !strings.Contains(f.Name, "/") {
+			return false // Not named after a media type.
+		}
+		if f.NativeType != first.NativeType || f.Kind != first.Kind {
+			return false
+		}
+	}
+	return true
+}
+
+// isV3RequestBody checks whether 'f' is the request body of a parameters type inside an OpenAPI v3 description.
+func isV3RequestBody(f *surface_v1.Field) bool {
+	return f.Name == "request_body"
+}
+
+// isV2RequestBody checks whether 'f' is the body parameter of a parameters type inside an OpenAPI v2 description.
+func isV2RequestBody(f *surface_v1.Field) bool {
+	return f.Position == surface_v1.Position_BODY
+}
+
+// removeTypes removes all types from the surface model that are marked inside 'typesToDelete'.
+func removeTypes(model *surface_v1.Model, typesToDelete map[*surface_v1.Type]bool) {
 	filteredTypes := make([]*surface_v1.Type, 0)
 	for _, t := range model.Types {
 		if shouldDelete, ok := typesToDelete[t]; ok && !shouldDelete {
@@ -249,7 +533,7 @@ func findLowestStatusCode(responses *surface_v1.Type, nameToType map[string]*sur
 	return nil
 }
 
-// initHashTables is a helper function to initialize two hash tables which are used in adjustV2Model and adjustV2Model
+// initHashTables is a helper function to initialize two hash tables which are used in adjustV2Model and adjustV3Model
 func initHashTables(model *surface_v1.Model) (map[string]*surface_v1.Type, map[*surface_v1.Type]bool) {
 	nameToType := make(map[string]*surface_v1.Type)
 	typesToDelete := make(map[*surface_v1.Type]bool)
@@ -0,0 +1,87 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"testing"
+
+	surface "github.com/google/gnostic/surface"
+)
+
+func TestNormalizationMessages(t *testing.T) {
+	input := "testfiles/requestBodies.yaml"
+	surfaceModel, err := buildSurfaceModel(input)
+	if err != nil {
+		t.Errorf("Error while parsing input file: %s", input)
+		return
+	}
+
+	languageModel := NewProtoLanguageModel()
+	languageModel.Prepare(surfaceModel, "openapi.v3.Document")
+	expectedMessageKeys := [][]string{
+		{"TestRequestBodyRequestBody"},
+		{"TestRequestBodyParameters"},
+		{"RequestBody"},
+		{"TestRequestBodyReferenceParameters"},
+		{"TestRequestBodyWithParameterRequestBody"},
+	}
+	validateKeys(t, expectedMessageKeys, languageModel.Messages())
+}
+
+func TestMapKeyMessages(t *testing.T) {
+	input := "testfiles/maps.yaml"
+	documentv3, err := ParseOpenAPIDoc(input)
+	if err != nil {
+		t.Errorf("Error while parsing input file: %s", input)
+		return
+	}
+	surfaceModel, err := surface.NewModelFromOpenAPI3(documentv3, input)
+	if err != nil {
+		t.Errorf("Error while building surface model for input file: %s", input)
+		return
+	}
+
+	languageModel := NewProtoLanguageModel()
+	languageModel.Document = documentv3
+	languageModel.Prepare(surfaceModel, "openapi.v3.Document")
+	expectedMessageKeys := [][]string{
+		{"components", "schemas", "Directory", "properties", "scores", "x-proto-map-key"},
+	}
+	validateKeys(t, expectedMessageKeys, languageModel.Messages())
+}
+
+func TestNamingMessages(t *testing.T) {
+	input := "testfiles/naming.yaml"
+	surfaceModel, err := buildSurfaceModel(input)
+	if err != nil {
+		t.Errorf("Error while parsing input file: %s", input)
+		return
+	}
+
+	languageModel := NewProtoLanguageModel()
+	languageModel.Prepare(surfaceModel, "openapi.v3.Document")
+	expectedMessageKeys := [][]string{
+		{"user_id"},
+		{"testNameOK"},
+		{"TestNameResponses"},
+		{"user-id", "first_name"},
+		{"user-id", "string"},
+		{"user-id", "status", "enum", "in-active"},
+		{"user-id", "status", "enum", "1st"},
+		{"user-id", "state", "enum", "active"},
+		{"paths", "/testNameCollisions2", "get"},
+	}
+	validateKeys(t, expectedMessageKeys, languageModel.Messages())
+}
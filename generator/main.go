@@ -19,12 +19,13 @@ import (
 	"errors"
 	"go/format"
 	"path/filepath"
+	"strconv"
 	"strings"
 
-	"github.com/golang/protobuf/proto"
-	openapiv3 "github.com/googleapis/gnostic/openapiv3"
-	plugins "github.com/googleapis/gnostic/plugins"
-	surface "github.com/googleapis/gnostic/surface"
+	openapiv3 "github.com/google/gnostic/openapiv3"
+	plugins "github.com/google/gnostic/plugins"
+	surface "github.com/google/gnostic/surface"
+	"google.golang.org/protobuf/proto"
 )
 
 // This is the main function for the code generation plugin.
@@ -32,39 +33,49 @@ func RunProtoGenerator() {
 	env, err := plugins.NewEnvironment()
 	env.RespondAndExitIfError(err)
 
-	fileName := env.Request.SourceName
-	for {
-		extension := filepath.Ext(fileName)
-		if extension == "" {
-			break
-		}
-		fileName = fileName[0 : len(fileName)-len(extension)]
-	}
-
-	packageName, err := resolvePackageName(fileName)
+	packageName, err := resolvePackageName(trimExtensions(env.Request.SourceName))
 	env.RespondAndExitIfError(err)
 
 	inputDocumentType := env.Request.Models[0].TypeUrl
+	var openAPIdocument *openapiv3.Document
 	for _, model := range env.Request.Models {
 		switch model.TypeUrl {
 		case "openapi.v3.Document":
-			openAPIdocument := &openapiv3.Document{}
-			err := proto.Unmarshal(model.Value, openAPIdocument)
+			document := &openapiv3.Document{}
+			err := proto.Unmarshal(model.Value, document)
 
 			if err == nil {
-				featureChecker := NewGrpcChecker(openAPIdocument)
-				env.Response.Messages = featureChecker.Run()
+				openAPIdocument = document
 			}
 		case "surface.v1.Model":
 			surfaceModel := &surface.Model{}
 			err = proto.Unmarshal(model.Value, surfaceModel)
 			if err == nil {
-				// Customizes the surface model for a .proto output file
-				NewProtoLanguageModel().Prepare(surfaceModel, inputDocumentType)
+				languageModel := NewProtoLanguageModel()
+				languageModel.Document = openAPIdocument
 
 				// Create the renderer.
 				renderer := NewRenderer(surfaceModel)
 				renderer.Package = packageName
+				renderer.Document = openAPIdocument
+
+				err = applyParameters(env.Request.Parameters, languageModel, renderer)
+				env.RespondAndExitIfError(err)
+
+				// The checker reports the features of the document that are not processed by the generator, which
+				// depend on the parameters.
+				if openAPIdocument != nil {
+					featureChecker := NewGrpcChecker(openAPIdocument)
+					featureChecker.ValidationRules = renderer.ValidationRules
+					featureChecker.OpenAPIAnnotations = renderer.OpenAPIAnnotations
+					featureChecker.GrpcAnnotations = renderer.GrpcAnnotations
+					featureChecker.ServicesByTag = renderer.ServicesByTag
+					env.Response.Messages = append(env.Response.Messages, featureChecker.Run()...)
+				}
+
+				// Customizes the surface model for a .proto output file
+				languageModel.Prepare(surfaceModel, inputDocumentType)
+				env.Response.Messages = append(env.Response.Messages, languageModel.Messages()...)
 
 				// Run the renderer to generate files and add them to the response object.
 				err = renderer.Render(env.Response, packageName+".proto")
@@ -78,6 +89,60 @@ func RunProtoGenerator() {
 	env.RespondAndExitIfError(err)
 }
 
+// RunCommonGenerator generates the .proto files for the OpenAPI v3 descriptions 'inputs' (file paths or URLs). Messages
+// that are shared by the descriptions are moved into 'common.proto' (see RenderWithCommonTypes). The parameters are the
+// same as the ones of the plugin. The descriptions are parsed with gnostic, which has to be installed.
+func RunCommonGenerator(inputs []string, parameters []*plugins.Parameter) (*plugins.Response, error) {
+	response := &plugins.Response{}
+	renderers := make([]*Renderer, 0)
+	for _, input := range inputs {
+		document, err := parseOpenAPIDocument(input)
+		if err != nil {
+			return nil, errors.New("could not parse " + input + ": " + err.Error())
+		}
+		surfaceModel, err := surface.NewModelFromOpenAPI3(document, input)
+		if err != nil {
+			return nil, err
+		}
+		packageName, err := resolvePackageName(trimExtensions(input))
+		if err != nil {
+			return nil, err
+		}
+
+		languageModel := NewProtoLanguageModel()
+		languageModel.Document = document
+		renderer := NewRenderer(surfaceModel)
+		renderer.Package = packageName
+		renderer.Document = document
+		if err := applyParameters(parameters, languageModel, renderer); err != nil {
+			return nil, err
+		}
+
+		checker := NewGrpcChecker(document)
+		checker.ValidationRules = renderer.ValidationRules
+		checker.OpenAPIAnnotations = renderer.OpenAPIAnnotations
+		checker.GrpcAnnotations = renderer.GrpcAnnotations
+		checker.ServicesByTag = renderer.ServicesByTag
+		response.Messages = append(response.Messages, checker.Run()...)
+		languageModel.Prepare(surfaceModel, "openapi.v3.Document")
+		response.Messages = append(response.Messages, languageModel.Messages()...)
+		renderers = append(renderers, renderer)
+	}
+	err := RenderWithCommonTypes(renderers, response)
+	return response, err
+}
+
+// trimExtensions removes all extensions from 'fileName' (e.g.: 'bookstore.openapi.yaml' becomes 'bookstore').
+func trimExtensions(fileName string) string {
+	for {
+		extension := filepath.Ext(fileName)
+		if extension == "" {
+			return fileName
+		}
+		fileName = fileName[0 : len(fileName)-len(extension)]
+	}
+}
+
 // resolvePackageName converts a path to a valid package name or
 // error if path can't be resolved or resolves to an invalid package name.
 func resolvePackageName(p string) (string, error) {
@@ -92,3 +157,71 @@ func resolvePackageName(p string) (string, error) {
 	}
 	return p, nil
 }
+
+// applyParameters sets the options of the language model and the renderer according to the parameters of the plugin.
+// Parameters are passed to the plugin like this: gnostic --grpc-out=nested_messages=true:output_directory input.yaml
+func applyParameters(parameters []*plugins.Parameter, languageModel *ProtoLanguageModel, renderer *Renderer) error {
+	for _, parameter := range parameters {
+		switch parameter.Name {
+		case "nested_messages":
+			value, err := strconv.ParseBool(parameter.Value)
+			if err != nil {
+				return errors.New("invalid value for parameter " + parameter.Name + ": " + parameter.Value)
+			}
+			renderer.NestInlineMessages = value
+		case "layout":
+			switch parameter.Value {
+			case "single":
+				renderer.SplitFiles = false
+			case "split":
+				renderer.SplitFiles = true
+			default:
+				return errors.New("invalid value for parameter " + parameter.Name + ": " + parameter.Value)
+			}
+		case "services_by_tag":
+			value, err := strconv.ParseBool(parameter.Value)
+			if err != nil {
+				return errors.New("invalid value for parameter " + parameter.Name + ": " + parameter.Value)
+			}
+			renderer.ServicesByTag = value
+		case "naming":
+			strategy, err := NewNamingStrategy(parameter.Value)
+			if err != nil {
+				return errors.New("invalid value for parameter " + parameter.Name + ": " + parameter.Value)
+			}
+			languageModel.NamingStrategy = strategy
+			renderer.NamingStrategy = strategy
+		case "descriptor_set":
+			if parameter.Value == "" {
+				return errors.New("invalid value for parameter " + parameter.Name + ": " + parameter.Value)
+			}
+			renderer.DescriptorSet = parameter.Value
+		case "validation_rules":
+			value, err := strconv.ParseBool(parameter.Value)
+			if err != nil {
+				return errors.New("invalid value for parameter " + parameter.Name + ": " + parameter.Value)
+			}
+			renderer.ValidationRules = value
+		case "openapi_annotations":
+			value, err := strconv.ParseBool(parameter.Value)
+			if err != nil {
+				return errors.New("invalid value for parameter " + parameter.Name + ": " + parameter.Value)
+			}
+			renderer.OpenAPIAnnotations = value
+		case "grpc_annotations":
+			value, err := strconv.ParseBool(parameter.Value)
+			if err != nil {
+				return errors.New("invalid value for parameter " + parameter.Name + ": " + parameter.Value)
+			}
+			renderer.GrpcAnnotations = value
+		case "go_package":
+			if parameter.Value == "" {
+				return errors.New("invalid value for parameter " + parameter.Name + ": " + parameter.Value)
+			}
+			renderer.GoPackage = parameter.Value
+		default:
+			return errors.New("unknown parameter " + parameter.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	surface_v1 "github.com/google/gnostic/surface"
+)
+
+// Keywords of the protocol buffers language that are easily confused with the syntax of the language (scalar types,
+// literals and labels). Fields with one of those names are renamed. Other keywords like 'message' or 'option' are
+// valid field names. Reference: https://developers.google.com/protocol-buffers/docs/reference/proto3-spec
+var protoKeywords = map[string]bool{
+	"double": true, "float": true, "int32": true, "int64": true, "uint32": true, "uint64": true,
+	"sint32": true, "sint64": true, "fixed32": true, "fixed64": true, "sfixed32": true, "sfixed64": true,
+	"bool": true, "string": true, "bytes": true, "true": true, "false": true, "inf": true, "nan": true,
+	"map": true, "oneof": true, "group": true, "optional": true, "repeated": true, "required": true,
+	"reserved": true, "extensions": true,
+}
+
+var invalidIdentifierCharacters = regexp.MustCompile("[^A-Za-z0-9_]")
+
+// resolveNameCollisions makes sure that distinct OpenAPI names are not mapped to the same protocol buffers identifier.
+// It renames messages, fields, nested enums and enum values of the surface model and rewrites the references of fields
+// to the renamed messages. Every rename is reported as message. The returned map maps the original name of a type to
+// its new name, so that methods can be updated accordingly.
+func (language *ProtoLanguageModel) resolveNameCollisions(model *surface_v1.Model) map[string]string {
+	typeNames := make(map[string]string)
+	takenTypeNames := make(map[string]bool)
+	for _, t := range model.Types {
+		name := uniqueName(t.TypeName, takenTypeNames, "")
+		if name != t.TypeName {
+			language.reportRename("message", t.TypeName, name, []string{t.Name})
+			t.TypeName = name
+		}
+		if _, ok := typeNames[t.Name]; !ok {
+			typeNames[t.Name] = t.TypeName
+		}
+	}
+
+	for _, t := range model.Types {
+		takenFieldNames := make(map[string]bool)
+		takenEnumNames := make(map[string]bool)
+		takenEnumValueNames := make(map[string]bool) // Enum values are siblings of the enums inside of the message.
+		for _, f := range t.Fields {
+			keys := []string{t.Name, f.Name}
+
+			name := f.FieldName
+			if protoKeywords[name] {
+				name += "_"
+			}
+			name = uniqueFieldName(name, takenFieldNames)
+			if name != f.FieldName {
+				language.reportRename("field", f.FieldName, name, keys)
+				f.FieldName = name
+			}
+
+			if f.EnumValues != nil {
+				language.resolveEnumNameCollisions(f, takenEnumNames, takenEnumValueNames, keys)
+				continue
+			}
+			renameTypeReference(f, typeNames)
+		}
+	}
+	return typeNames
+}
+
+// resolveEnumNameCollisions renames the nested enum of 'f' and its values, if they collide with other enums or enum
+// values inside of the same message. Enum values are converted to valid identifiers.
+func (language *ProtoLanguageModel) resolveEnumNameCollisions(f *surface_v1.Field, takenEnumNames map[string]bool,
+	takenEnumValueNames map[string]bool, keys []string) {
+	enumName := f.NativeType
+	prefix := ""
+	if f.Kind == surface_v1.FieldKind_MAP {
+		keyType, valueType := getMapKeyAndValueType(f.NativeType)
+		prefix, enumName = "map["+keyType+"]", valueType
+	}
+	name := uniqueName(enumName, takenEnumNames, "")
+	if name != enumName {
+		language.reportRename("enum", enumName, name, append(copyKeys(keys), "enum"))
+		f.NativeType = prefix + name
+	}
+
+	enumPrefix := strings.ToUpper(toSnakeCase(name))
+	for i, value := range f.EnumValues {
+		valueName := strings.ToUpper(invalidIdentifierCharacters.ReplaceAllString(CleanName(value), "_"))
+		if valueName == "" || (valueName[0] >= '0' && valueName[0] <= '9') {
+			valueName = enumPrefix + "_" + valueName // Identifiers have to start with a letter.
+		}
+		if takenEnumValueNames[valueName] {
+			valueName = enumPrefix + "_" + valueName
+		}
+		valueName = uniqueName(valueName, takenEnumValueNames, "_")
+		if valueName != strings.ToUpper(value) {
+			language.reportRename("enum value", value, valueName, append(copyKeys(keys), "enum", value))
+		}
+		f.EnumValues[i] = valueName
+	}
+}
+
+// resolveMethodNameCollisions renames RPCs with the same name.
+func (language *ProtoLanguageModel) resolveMethodNameCollisions(model *surface_v1.Model) {
+	takenMethodNames := make(map[string]bool)
+	for _, m := range model.Methods {
+		name := uniqueName(m.HandlerName, takenMethodNames, "")
+		if name != m.HandlerName {
+			language.reportRename("RPC", m.HandlerName, name, []string{"paths", m.Path, strings.ToLower(m.Method)})
+			m.HandlerName = name
+		}
+	}
+}
+
+// reportRename adds a message which tells the user that an identifier has been renamed.
+func (language *ProtoLanguageModel) reportRename(kind string, oldName string, newName string, keys []string) {
+	text := "The " + kind + " '" + oldName + "' has been renamed to '" + newName + "' to avoid a name collision " +
+		"or an invalid identifier inside the .proto file."
+	msg := constructInfoMessage("NAMING", text, keys)
+	language.messages = append(language.messages, &msg)
+}
+
+// renameTypeReference updates the native type of 'f' if it references a type that has been renamed.
+func renameTypeReference(f *surface_v1.Field, typeNames map[string]string) {
+	if f.Kind == surface_v1.FieldKind_MAP {
+		keyType, valueType := getMapKeyAndValueType(f.NativeType)
+		originalValueType := strings.TrimPrefix(f.Type[strings.Index(f.Type, "]")+1:], "[]")
+		if newName, ok := typeNames[originalValueType]; ok && strings.TrimPrefix(valueType, "[]") == protoTypeName(originalValueType) {
+			arrayPrefix := valueType[:len(valueType)-len(strings.TrimPrefix(valueType, "[]"))]
+			f.NativeType = "map[" + keyType + "]" + arrayPrefix + newName
+		}
+		return
+	}
+	if newName, ok := typeNames[f.Type]; ok && f.NativeType == protoTypeName(f.Type) {
+		f.NativeType = newName
+	}
+}
+
+// uniqueName returns 'name' if it is not taken yet. Otherwise a number is appended (e.g.: 'Name2', 'Name3'). The
+// returned name is marked as taken.
+func uniqueName(name string, taken map[string]bool, separator string) string {
+	unique := name
+	for ctr := 2; taken[unique]; ctr++ {
+		unique = name + separator + strconv.Itoa(ctr)
+	}
+	taken[unique] = true
+	return unique
+}
+
+// uniqueFieldName returns a field name that neither collides with the name nor with the JSON name of another field.
+func uniqueFieldName(name string, taken map[string]bool) string {
+	unique := name
+	for ctr := 2; taken[unique] || taken[jsonName(unique)]; ctr++ {
+		unique = name + "_" + strconv.Itoa(ctr)
+	}
+	taken[unique] = true
+	taken[jsonName(unique)] = true
+	return unique
+}
+
+// jsonName returns the JSON name protocol buffers derives from a field name (lowerCamelCase).
+// Reference: https://developers.google.com/protocol-buffers/docs/proto3#json
+func jsonName(fieldName string) string {
+	var result strings.Builder
+	upperNext := false
+	for _, c := range fieldName {
+		if c == '_' {
+			upperNext = true
+			continue
+		}
+		if upperNext && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upperNext = false
+		result.WriteRune(c)
+	}
+	return result.String()
+}
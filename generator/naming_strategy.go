@@ -0,0 +1,217 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"errors"
+	"strings"
+
+	surface_v1 "github.com/google/gnostic/surface"
+)
+
+// NamingStrategy decides on the names of the RPCs, the service and the request and response messages that are
+// generated for the operations of an API description.
+type NamingStrategy interface {
+	// RPCName returns the name of the RPC for the method 'm'.
+	RPCName(m *surface_v1.Method) string
+	// RequestMessageName returns the name of the message 't' which is the input of the RPC for 'm'. It is only called
+	// for messages that were generated for 'm' and are not used anywhere else.
+	RequestMessageName(m *surface_v1.Method, t *surface_v1.Type) string
+	// ResponseMessageName returns the name of the message 't' which is the output of the RPC for 'm'. It is only called
+	// for messages that were generated for 'm' and are not used anywhere else.
+	ResponseMessageName(m *surface_v1.Method, t *surface_v1.Type) string
+	// ServiceName returns the name of the service for the package 'packageName'.
+	ServiceName(packageName string) string
+}
+
+// NewNamingStrategy returns the naming strategy with the name 'name' ("legacy" or "aip").
+func NewNamingStrategy(name string) (NamingStrategy, error) {
+	switch name {
+	case "legacy":
+		return LegacyNamingStrategy{}, nil
+	case "aip":
+		return AIPNamingStrategy{}, nil
+	}
+	return nil, errors.New("unknown naming strategy " + name)
+}
+
+// LegacyNamingStrategy names RPCs after the operationId, request messages end in 'Parameters' and the service is named
+// after the package. This is the default.
+type LegacyNamingStrategy struct{}
+
+// RPCName returns the operationId (or the name gnostic generated from method and path) in UpperCamelCase.
+func (LegacyNamingStrategy) RPCName(m *surface_v1.Method) string {
+	return protoTypeName(m.Name)
+}
+
+// RequestMessageName keeps the name of the message.
+func (LegacyNamingStrategy) RequestMessageName(m *surface_v1.Method, t *surface_v1.Type) string {
+	return t.TypeName
+}
+
+// ResponseMessageName keeps the name of the message.
+func (LegacyNamingStrategy) ResponseMessageName(m *surface_v1.Method, t *surface_v1.Type) string {
+	return t.TypeName
+}
+
+// ServiceName returns the package name with an upper case first letter.
+func (LegacyNamingStrategy) ServiceName(packageName string) string {
+	return strings.Title(packageName)
+}
+
+// AIPNamingStrategy names RPCs after the standard methods of the API Improvement Proposals (e.g.: 'GetBook',
+// 'ListBooks', 'CreateBook', 'UpdateBook' and 'DeleteBook'). Request and response messages are named after the RPC
+// (e.g.: 'GetBookRequest', 'ListBooksResponse') and the service gets the suffix 'Service'. Operations that do not
+// match a standard method are named after their operationId.
+// Reference: https://google.aip.dev/121 and https://google.aip.dev/190
+type AIPNamingStrategy struct{}
+
+// RPCName returns the name of the standard method that corresponds to the HTTP method and the path of 'm'.
+func (AIPNamingStrategy) RPCName(m *surface_v1.Method) string {
+	collection, isResource := parseResourcePath(m.Path)
+	if collection == "" {
+		return protoTypeName(m.Name)
+	}
+	plural := protoTypeName(collection)
+	singular := protoTypeName(singularize(collection))
+
+	switch {
+	case !isResource && m.Method == "GET":
+		return "List" + plural
+	case !isResource && m.Method == "POST":
+		return "Create" + singular
+	case isResource && m.Method == "GET":
+		return "Get" + singular
+	case isResource && (m.Method == "PUT" || m.Method == "PATCH"):
+		return "Update" + singular
+	case isResource && m.Method == "DELETE":
+		return "Delete" + singular
+	}
+	return protoTypeName(m.Name)
+}
+
+// RequestMessageName returns the name of the RPC with the suffix 'Request'.
+func (AIPNamingStrategy) RequestMessageName(m *surface_v1.Method, t *surface_v1.Type) string {
+	return m.HandlerName + "Request"
+}
+
+// ResponseMessageName returns the name of the RPC with the suffix 'Response'.
+func (AIPNamingStrategy) ResponseMessageName(m *surface_v1.Method, t *surface_v1.Type) string {
+	return m.HandlerName + "Response"
+}
+
+// ServiceName returns the package name in UpperCamelCase with the suffix 'Service'.
+func (AIPNamingStrategy) ServiceName(packageName string) string {
+	return protoTypeName(packageName) + "Service"
+}
+
+// parseResourcePath returns the last collection of 'path' (e.g.: 'books' for '/shelves/{shelf}/books/{book}') and
+// whether 'path' points to a single resource of that collection. An empty collection is returned for paths that do not
+// follow the resource oriented design (e.g.: custom methods like '/books/{book}:publish').
+func parseResourcePath(path string) (collection string, isResource bool) {
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) == 0 || strings.Contains(path, ":") {
+		return "", false
+	}
+
+	last := segments[len(segments)-1]
+	if !isPathParameter(last) {
+		return last, false
+	}
+	if len(segments) < 2 || isPathParameter(segments[len(segments)-2]) {
+		return "", false
+	}
+	return segments[len(segments)-2], true
+}
+
+// isPathParameter checks whether the path segment 'segment' is a path template (e.g.: '{id}').
+func isPathParameter(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// singularize returns the singular of the english noun 'plural'. Only regular nouns are supported.
+func singularize(plural string) string {
+	switch {
+	case strings.HasSuffix(plural, "ies") && len(plural) > 3:
+		return strings.TrimSuffix(plural, "ies") + "y"
+	case strings.HasSuffix(plural, "sses"), strings.HasSuffix(plural, "xes"),
+		strings.HasSuffix(plural, "ches"), strings.HasSuffix(plural, "shes"):
+		return strings.TrimSuffix(plural, "es")
+	case strings.HasSuffix(plural, "ss"):
+		return plural
+	case strings.HasSuffix(plural, "s"):
+		return strings.TrimSuffix(plural, "s")
+	}
+	return plural
+}
+
+// applyNamingStrategy renames the request and response messages that belong to a single RPC according to the naming
+// strategy of the language model.
+func (language *ProtoLanguageModel) applyNamingStrategy(model *surface_v1.Model) {
+	usages := countTypeUsages(model)
+	takenTypeNames := make(map[string]bool)
+	for _, t := range model.Types {
+		takenTypeNames[t.TypeName] = true
+	}
+
+	rename := func(m *surface_v1.Method, typeName string, newName func(*surface_v1.Method, *surface_v1.Type) string) string {
+		t := model.TypeWithTypeName(typeName)
+		if t == nil || usages[typeName] != 1 || !isGeneratedForMethod(t, m) {
+			return typeName
+		}
+		name := newName(m, t)
+		if name == t.TypeName {
+			return typeName
+		}
+		name = uniqueName(name, takenTypeNames, "")
+		t.TypeName = name
+		return name
+	}
+
+	for _, m := range model.Methods {
+		m.ParametersTypeName = rename(m, m.ParametersTypeName, language.NamingStrategy.RequestMessageName)
+		m.ResponsesTypeName = rename(m, m.ResponsesTypeName, language.NamingStrategy.ResponseMessageName)
+	}
+}
+
+// countTypeUsages counts how often every message of 'model' is used as input or output of an RPC or as type of a field.
+func countTypeUsages(model *surface_v1.Model) map[string]int {
+	usages := make(map[string]int)
+	for _, m := range model.Methods {
+		usages[m.ParametersTypeName]++
+		usages[m.ResponsesTypeName]++
+	}
+	for _, t := range model.Types {
+		for _, f := range t.Fields {
+			nativeType := f.NativeType
+			if f.Kind == surface_v1.FieldKind_MAP {
+				_, nativeType = getMapKeyAndValueType(nativeType)
+			}
+			usages[strings.TrimLeft(nativeType, "[]")]++
+		}
+	}
+	return usages
+}
+
+// isGeneratedForMethod checks whether 't' has been generated for the method 'm' (e.g.: parameters or inline request
+// bodies and responses of the operation), instead of being a component of the API description.
+func isGeneratedForMethod(t *surface_v1.Type, m *surface_v1.Method) bool {
+	return isRequestParameter(t) || strings.HasPrefix(protoTypeName(t.Name), protoTypeName(m.Name))
+}
@@ -15,13 +15,21 @@
 package generator
 
 import (
-	"github.com/golang/protobuf/proto"
-	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
-	plugins "github.com/googleapis/gnostic/plugins"
-	surface "github.com/googleapis/gnostic/surface"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	openapiv3 "github.com/google/gnostic/openapiv3"
+	plugins "github.com/google/gnostic/plugins"
+	surface "github.com/google/gnostic/surface"
 	prDesc "github.com/jhump/protoreflect/desc"
+	prParse "github.com/jhump/protoreflect/desc/protoparse"
 	prPrint "github.com/jhump/protoreflect/desc/protoprint"
-	_ "os"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	dpb "google.golang.org/protobuf/types/descriptorpb"
 )
 
 // Renderer generates a .proto file based on the information inside Model.
@@ -32,6 +40,51 @@ type Renderer struct {
 	FdSet          *dpb.FileDescriptorSet
 	SymbolicFdSets []*dpb.FileDescriptorSet
 	Package        string // package name
+	// The OpenAPI v3 document the model was built from. It is optional and used to recover information that is not
+	// contained inside the model.
+	Document *openapiv3.Document
+
+	// Options that can be set with plugin parameters.
+
+	// If true, inline object schemas that are used by a single message are rendered as nested messages of that message.
+	NestInlineMessages bool
+	// If true, messages and services are rendered into separate files ('<package>_messages.proto' and
+	// '<package>_service.proto').
+	SplitFiles bool
+	// If true, operations are grouped into one service per tag.
+	ServicesByTag bool
+	// If set, a FileDescriptorSet of the generated files is written to this file (see RenderDescriptor).
+	DescriptorSet string
+	// If true, the validation keywords of schemas are rendered as buf.validate rules of the fields (see
+	// setValidationRules).
+	ValidationRules bool
+	// If true, information of the OpenAPI description that can't be represented otherwise (e.g.: default values) is
+	// rendered as options of gnostic's openapiv3/annotations.proto, which are read by protoc-gen-openapi.
+	OpenAPIAnnotations bool
+	// If true, the parts of operations that gRPC doesn't represent inside of messages (e.g.: security requirements) are
+	// rendered as options of annotations/annotations.proto, together with a Go file with helpers for the servers.
+	GrpcAnnotations bool
+	// If set, the option 'go_package' of the generated file, which names the package of the Go file with the helpers
+	// as well (see renderGoHelpers).
+	GoPackage string
+	// The name of the generated .proto file. If empty, the file is named after the package.
+	fileName string
+	// The directory (split into segments) the paths of the .proto files of symbolic references are relative to.
+	symbolicBase []string
+	// The files generated for symbolic references by their location. Every entry lists the file of the reference last,
+	// after the files it depends on. Shared by the renderers of the symbolic references.
+	symbolicFiles map[string][]*dpb.FileDescriptorProto
+	// The location of the OpenAPI description of a symbolic reference. Empty for the converted description itself.
+	location string
+	// The OpenAPI elements the messages, fields and RPCs of the generated files were built from. Used to report
+	// problems of the generated files (see validateFileDescriptors). Shared by the renderers of the symbolic references.
+	origins map[proto.Message]origin
+	// The fully qualified names of the messages that were nested into other messages (see nestInlineMessages) by the
+	// names of their types. Shared by the renderers of the symbolic references.
+	nestedMessages map[string]string
+
+	// Decides on the name of the service and is passed on to the language models of symbolic references.
+	NamingStrategy NamingStrategy
 }
 
 // NewRenderer creates a renderer.
@@ -39,9 +92,34 @@ func NewRenderer(model *surface.Model) (renderer *Renderer) {
 	renderer = &Renderer{}
 	renderer.Model = model
 	renderer.SymbolicFdSets = make([]*dpb.FileDescriptorSet, 0)
+	renderer.NamingStrategy = LegacyNamingStrategy{}
+	renderer.origins = make(map[proto.Message]origin)
+	renderer.nestedMessages = make(map[string]string)
 	return renderer
 }
 
+// setOrigin records that 'element' (a message, field or RPC) was built from the OpenAPI element with the keys 'keys'.
+func (renderer *Renderer) setOrigin(element proto.Message, keys []string) {
+	renderer.origins[element] = origin{location: renderer.location, keys: keys}
+}
+
+// newSymbolicRenderer creates a renderer for a symbolic reference. The options of 'renderer' are passed on.
+func (renderer *Renderer) newSymbolicRenderer(model *surface.Model, document *openapiv3.Document) *Renderer {
+	symbolicRenderer := NewRenderer(model)
+	symbolicRenderer.Document = document
+	symbolicRenderer.NestInlineMessages = renderer.NestInlineMessages
+	symbolicRenderer.NamingStrategy = renderer.NamingStrategy
+	symbolicRenderer.ServicesByTag = renderer.ServicesByTag
+	symbolicRenderer.ValidationRules = renderer.ValidationRules
+	symbolicRenderer.OpenAPIAnnotations = renderer.OpenAPIAnnotations
+	symbolicRenderer.GrpcAnnotations = renderer.GrpcAnnotations
+	symbolicRenderer.symbolicBase = renderer.symbolicBase
+	symbolicRenderer.symbolicFiles = renderer.symbolicFiles
+	symbolicRenderer.origins = renderer.origins
+	symbolicRenderer.nestedMessages = renderer.nestedMessages
+	return symbolicRenderer
+}
+
 // Generate runs the renderer to generate the named files.
 func (renderer *Renderer) Render(response *plugins.Response, fileName string) (err error) {
 	renderer.FdSet, err = renderer.runFileDescriptorSetGenerator()
@@ -49,25 +127,59 @@ func (renderer *Renderer) Render(response *plugins.Response, fileName string) (e
 	if err != nil {
 		return err
 	}
-
-	if false { //TODO: If we want to generate the descriptor file, we need an additional flag here!
-		f, err := renderer.RenderDescriptor()
-		if err != nil {
-			return err
-		}
-		response.Files = append(response.Files, f)
+	if err = renderer.validateFileDescriptors(response); err != nil {
+		return err
+	}
+	rendered := len(response.Files)
+	if err = renderer.renderFiles(response, fileName); err != nil {
+		return err
+	}
+	if err = renderer.renderDescriptorSet(response, rendered); err != nil {
+		return err
 	}
+	if renderer.GrpcAnnotations {
+		return renderer.renderGoHelpers(response)
+	}
+	return nil
+}
 
-	// Render main proto definition.
-	f, err := renderer.RenderProto(renderer.FdSet, fileName)
+// renderDescriptorSet adds the FileDescriptorSet of the files of 'response' starting at index 'rendered' to
+// 'response', if the parameter 'descriptor_set' is set.
+func (renderer *Renderer) renderDescriptorSet(response *plugins.Response, rendered int) error {
+	if renderer.DescriptorSet == "" {
+		return nil
+	}
+	f, err := renderer.RenderDescriptor(response.Files[rendered:])
 	if err != nil {
 		return err
 	}
 	response.Files = append(response.Files, f)
+	return nil
+}
+
+// renderFiles renders the FileDescriptorSet of the renderer and the FileDescriptorSets of the symbolic references.
+func (renderer *Renderer) renderFiles(response *plugins.Response, fileName string) (err error) {
+	// Render main proto definition.
+	if renderer.SplitFiles {
+		messagesSet, servicesSet := splitMessagesAndServices(renderer.FdSet)
+		for _, fdSet := range []*dpb.FileDescriptorSet{messagesSet, servicesSet} {
+			f, err := renderer.RenderProto(fdSet, *getLast(fdSet.File).Name)
+			if err != nil {
+				return err
+			}
+			response.Files = append(response.Files, f)
+		}
+	} else {
+		f, err := renderer.RenderProto(renderer.FdSet, fileName)
+		if err != nil {
+			return err
+		}
+		response.Files = append(response.Files, f)
+	}
 
 	// Render external proto definitions.
 	for _, externalSet := range renderer.SymbolicFdSets {
-		f, err = renderer.RenderProto(externalSet, *getLast(externalSet.File).Name)
+		f, err := renderer.RenderProto(externalSet, *getLast(externalSet.File).Name)
 		if err != nil {
 			return err
 		}
@@ -78,6 +190,11 @@ func (renderer *Renderer) Render(response *plugins.Response, fileName string) (e
 }
 
 func (renderer *Renderer) RenderProto(fdSet *dpb.FileDescriptorSet, fileName string) (*plugins.File, error) {
+	// Validates the descriptors the same way protoc would, this returns more precise errors than protoreflect.
+	if _, err := protodesc.NewFiles(fdSet); err != nil {
+		return nil, err
+	}
+
 	// Creates a protoreflect FileDescriptor, which is then used for printing.
 	prFd, err := prDesc.CreateFileDescriptorFromSet(fdSet)
 	if err != nil {
@@ -100,13 +217,59 @@ func (renderer *Renderer) RenderProto(fdSet *dpb.FileDescriptorSet, fileName str
 	return file, err
 }
 
-func (renderer *Renderer) RenderDescriptor() (*plugins.File, error) {
-	fdSetData, err := proto.Marshal(renderer.FdSet)
+// RenderDescriptor returns a FileDescriptorSet of the .proto files 'files' and all files they import, which is named
+// after the parameter 'descriptor_set'. The set is equivalent to the output of 'protoc --include_imports
+// --include_source_info': The files are parsed again, so that the source code info matches the rendered files. Imports
+// come before the files that import them. Imported files that are not part of 'files' (e.g.: the HTTP annotations)
+// are taken from the descriptors that are compiled into this plugin, they don't have source code info.
+func (renderer *Renderer) RenderDescriptor(files []*plugins.File) (*plugins.File, error) {
+	sources := make(map[string][]byte)
+	fileNames := make([]string, 0)
+	for _, f := range files {
+		if strings.HasSuffix(f.Name, ".proto") {
+			sources[f.Name] = f.Data
+			fileNames = append(fileNames, f.Name)
+		}
+	}
+
+	parser := prParse.Parser{
+		Accessor: func(fileName string) (io.ReadCloser, error) {
+			if data, ok := sources[fileName]; ok {
+				return ioutil.NopCloser(bytes.NewReader(data)), nil
+			}
+			return nil, os.ErrNotExist
+		},
+		LookupImport:          prDesc.LoadFileDescriptor,
+		IncludeSourceCodeInfo: true,
+	}
+	fds, err := parser.ParseFiles(fileNames...)
+	if err != nil {
+		return nil, err
+	}
+
+	fdSet := &dpb.FileDescriptorSet{}
+	added := make(map[string]bool)
+	var add func(fd *prDesc.FileDescriptor)
+	add = func(fd *prDesc.FileDescriptor) {
+		if added[fd.GetName()] {
+			return
+		}
+		added[fd.GetName()] = true
+		for _, dependency := range fd.GetDependencies() {
+			add(dependency)
+		}
+		fdSet.File = append(fdSet.File, fd.AsFileDescriptorProto())
+	}
+	for _, fd := range fds {
+		add(fd)
+	}
+
+	fdSetData, err := proto.Marshal(fdSet)
 	if err != nil {
 		return nil, err
 	}
 
-	descriptorFile := &plugins.File{Name: renderer.Package + ".descr"}
+	descriptorFile := &plugins.File{Name: renderer.DescriptorSet}
 	descriptorFile.Data = fdSetData
 	return descriptorFile, nil
 }
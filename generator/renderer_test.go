@@ -15,7 +15,12 @@
 package generator
 
 import (
-	surface "github.com/googleapis/gnostic/surface"
+	openapiv3 "github.com/google/gnostic/openapiv3"
+	plugins "github.com/google/gnostic/plugins"
+	surface "github.com/google/gnostic/surface"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	dpb "google.golang.org/protobuf/types/descriptorpb"
 	"io/ioutil"
 	"os"
 	"path"
@@ -75,34 +80,607 @@ func TestFileDescriptorGeneratorOther(t *testing.T) {
 	}
 	checkContents(t, string(protoData), "goldstandard/other.proto")
 
-	erroneousInput := []string{"testfiles/errors/cyclic_dependency_1.yaml"}
+	// Descriptions that reference each other are rendered into a single file instead of importing each other.
+	_, err = runGeneratorWithoutEnvironment("testfiles/errors/cyclic_dependency_1.yaml", "cyclic_dependency_1")
+	if err != nil {
+		handleError(err, t)
+	}
+}
+
+func TestFileDescriptorGeneratorArrays(t *testing.T) {
+	input := "testfiles/arrays.yaml"
+
+	protoData, err := runGeneratorWithoutEnvironment(input, "arrays")
+	if err != nil {
+		handleError(err, t)
+	}
+	checkContents(t, string(protoData), "goldstandard/arrays.proto")
+}
+
+func TestFileDescriptorGeneratorMaps(t *testing.T) {
+	input := "testfiles/maps.yaml"
+
+	protoData, err := runGeneratorWithoutEnvironment(input, "maps")
+	if err != nil {
+		handleError(err, t)
+	}
+	checkContents(t, string(protoData), "goldstandard/maps.proto")
+}
+
+func TestFileDescriptorGeneratorFreeForm(t *testing.T) {
+	input := "testfiles/freeform.yaml"
+
+	protoData, err := runGeneratorWithoutEnvironment(input, "freeform")
+	if err != nil {
+		handleError(err, t)
+	}
+	checkContents(t, string(protoData), "goldstandard/freeform.proto")
+}
+
+func TestFileDescriptorGeneratorNestedMessages(t *testing.T) {
+	input := "testfiles/nested.yaml"
+
+	protoData, err := runGeneratorWithParameters(input, "nested", map[string]string{"nested_messages": "true"})
+	if err != nil {
+		handleError(err, t)
+	}
+	checkContents(t, string(protoData), "goldstandard/nested.proto")
+}
+
+func TestFileDescriptorGeneratorNaming(t *testing.T) {
+	input := "testfiles/naming.yaml"
+
+	protoData, err := runGeneratorWithoutEnvironment(input, "naming")
+	if err != nil {
+		handleError(err, t)
+	}
+	checkContents(t, string(protoData), "goldstandard/naming.proto")
+}
+
+func TestFileDescriptorGeneratorJsonNames(t *testing.T) {
+	input := "testfiles/jsonnames.yaml"
+
+	protoData, err := runGeneratorWithoutEnvironment(input, "jsonnames")
+	if err != nil {
+		handleError(err, t)
+	}
+	checkContents(t, string(protoData), "goldstandard/jsonnames.proto")
+}
+
+func TestFileDescriptorGeneratorRecursion(t *testing.T) {
+	input := "testfiles/recursion.yaml"
+
+	protoData, err := runGeneratorWithoutEnvironment(input, "recursion")
+	if err != nil {
+		handleError(err, t)
+	}
+	checkContents(t, string(protoData), "goldstandard/recursion.proto")
+
+	// Inline messages that reference the message they are nested into.
+	protoData, err = runGeneratorWithParameters(input, "recursion", map[string]string{"nested_messages": "true"})
+	if err != nil {
+		handleError(err, t)
+	}
+	checkContents(t, string(protoData), "goldstandard/recursion_nested.proto")
+}
+
+func TestFileDescriptorGeneratorAIPNaming(t *testing.T) {
+	input := "testfiles/aip.yaml"
+
+	protoData, err := runGeneratorWithParameters(input, "library", map[string]string{"naming": "aip"})
+	if err != nil {
+		handleError(err, t)
+	}
+	checkContents(t, string(protoData), "goldstandard/aip.proto")
+}
+
+func TestFileDescriptorGeneratorServicesByTag(t *testing.T) {
+	input := "testfiles/tags.yaml"
+
+	protoData, err := runGeneratorWithParameters(input, "tags", map[string]string{"services_by_tag": "true"})
+	if err != nil {
+		handleError(err, t)
+	}
+	checkContents(t, string(protoData), "goldstandard/tags.proto")
+}
+
+func TestFileDescriptorGeneratorValidationRules(t *testing.T) {
+	input := "testfiles/validation.yaml"
+
+	protoData, err := runGeneratorWithParameters(input, "validation", map[string]string{"validation_rules": "true"})
+	if err != nil {
+		handleError(err, t)
+	}
+	checkContents(t, string(protoData), "goldstandard/validation.proto")
+}
+
+func TestFileDescriptorGeneratorDefaultValues(t *testing.T) {
+	input := "testfiles/defaults.yaml"
+
+	protoData, err := runGeneratorWithParameters(input, "defaults", map[string]string{"openapi_annotations": "true"})
+	if err != nil {
+		handleError(err, t)
+	}
+	checkContents(t, string(protoData), "goldstandard/defaults.proto")
+}
+
+func TestFileDescriptorGeneratorOpenAPIAnnotations(t *testing.T) {
+	input := "testfiles/roundtrip.yaml"
+
+	protoData, err := runGeneratorWithParameters(input, "roundtrip", map[string]string{"openapi_annotations": "true"})
+	if err != nil {
+		handleError(err, t)
+	}
+	checkContents(t, string(protoData), "goldstandard/roundtrip.proto")
+}
+
+func TestFileDescriptorGeneratorDeprecated(t *testing.T) {
+	input := "testfiles/deprecated.yaml"
+
+	protoData, err := runGeneratorWithParameters(input, "deprecated", map[string]string{})
+	if err != nil {
+		handleError(err, t)
+	}
+	checkContents(t, string(protoData), "goldstandard/deprecated.proto")
+}
+
+func TestFileDescriptorGeneratorSecurity(t *testing.T) {
+	checkGrpcAnnotations(t, "testfiles/security.yaml", "security", map[string]string{})
+}
+
+func TestFileDescriptorGeneratorHeaders(t *testing.T) {
+	checkGrpcAnnotations(t, "testfiles/headers.yaml", "headers", map[string]string{})
+}
+
+func TestFileDescriptorGeneratorResponseHeaders(t *testing.T) {
+	checkGrpcAnnotations(t, "testfiles/responseHeaders.yaml", "responseheaders", map[string]string{})
+}
+
+func TestFileDescriptorGeneratorGoPackage(t *testing.T) {
+	checkGrpcAnnotations(t, "testfiles/security.yaml", "gopackage",
+		map[string]string{"go_package": "github.com/example/petstore-api/v1;petstore"})
+}
+
+// checkGrpcAnnotations renders 'input' with the parameter 'grpc_annotations' and the parameters 'parameters' and
+// compares the .proto file and the Go helpers with their golden files.
+func checkGrpcAnnotations(t *testing.T, input string, packageName string, parameters map[string]string) {
+	parameters["grpc_annotations"] = "true"
+	r, err := prepareRenderer(input, packageName, parameters)
+	if err != nil {
+		handleError(err, t)
+		return
+	}
+	response := &plugins.Response{}
+	if err := r.Render(response, packageName+".proto"); err != nil {
+		handleError(err, t)
+		return
+	}
+	expectedFiles := []string{packageName + ".proto", packageName + "_gnostic.go"}
+	if len(response.Files) != len(expectedFiles) {
+		t.Fatalf("Expected %d files, got %d", len(expectedFiles), len(response.Files))
+	}
+	for i, f := range response.Files {
+		if f.Name != expectedFiles[i] {
+			t.Errorf("Expected file %s, got %s", expectedFiles[i], f.Name)
+		}
+		// The golden Go file is not named *.go, otherwise it would be compiled.
+		goldenFileName := "goldstandard/" + expectedFiles[i]
+		if strings.HasSuffix(goldenFileName, ".go") {
+			goldenFileName += ".golden"
+		}
+		checkContents(t, string(f.Data), goldenFileName)
+	}
+}
+
+func TestFileDescriptorGeneratorSplitLayout(t *testing.T) {
+	input := "testfiles/tags.yaml"
+
+	r, err := prepareRenderer(input, "split", map[string]string{"layout": "split", "services_by_tag": "true"})
+	if err != nil {
+		handleError(err, t)
+		return
+	}
+	response := &plugins.Response{}
+	if err := r.Render(response, "split.proto"); err != nil {
+		handleError(err, t)
+		return
+	}
+	expectedFiles := []string{"split_messages.proto", "split_service.proto"}
+	if len(response.Files) != len(expectedFiles) {
+		t.Fatalf("Expected %d files, got %d", len(expectedFiles), len(response.Files))
+	}
+	for i, f := range response.Files {
+		if f.Name != expectedFiles[i] {
+			t.Errorf("Expected file %s, got %s", expectedFiles[i], f.Name)
+		}
+		checkContents(t, string(f.Data), "goldstandard/"+expectedFiles[i])
+	}
+}
+
+func TestRenderWithCommonTypes(t *testing.T) {
+	inputs := []string{"testfiles/common/petstore.yaml", "testfiles/common/users.yaml"}
+
+	response, err := RunCommonGenerator(inputs, nil)
+	if err != nil {
+		handleError(err, t)
+		return
+	}
+	expectedFiles := []string{"common.proto", "petstore.proto", "users.proto"}
+	if len(response.Files) != len(expectedFiles) {
+		t.Fatalf("Expected %d files, got %d", len(expectedFiles), len(response.Files))
+	}
+	for i, f := range response.Files {
+		if f.Name != expectedFiles[i] {
+			t.Errorf("Expected file %s, got %s", expectedFiles[i], f.Name)
+		}
+		checkContents(t, string(f.Data), "goldstandard/common/"+expectedFiles[i])
+	}
+}
+
+func TestRenderWithCommonTypesByStructure(t *testing.T) {
+	inputs := []string{"testfiles/common/petstore.yaml", "testfiles/common/users.yaml", "testfiles/common/orders.yaml"}
+
+	response, err := RunCommonGenerator(inputs, nil)
+	if err != nil {
+		handleError(err, t)
+		return
+	}
+	expectedFiles := []string{"common.proto", "petstore.proto", "users.proto", "orders.proto"}
+	if len(response.Files) != len(expectedFiles) {
+		t.Fatalf("Expected %d files, got %d", len(expectedFiles), len(response.Files))
+	}
+	for i, f := range response.Files {
+		if f.Name != expectedFiles[i] {
+			t.Errorf("Expected file %s, got %s", expectedFiles[i], f.Name)
+		}
+		checkContents(t, string(f.Data), "goldstandard/commonstructure/"+expectedFiles[i])
+	}
+}
+
+func TestFileDescriptorGeneratorSymbolicReferencePaths(t *testing.T) {
+	inputFiles := []string{"main.yaml", "a/models.yaml", "b/models.yaml"}
+	expectedFiles := []string{"symbolic.proto", "a/models.proto", "b/models.proto"}
+	checkSymbolicReferences(t, "symbolic", inputFiles, expectedFiles, nil)
+}
+
+func TestFileDescriptorGeneratorCyclicSymbolicReferences(t *testing.T) {
+	inputFiles := []string{"main.yaml", "a/models.yaml", "b/models.yaml", "c/types.yaml"}
+	// a/models.yaml and b/models.yaml reference each other and are rendered into a/models.proto.
+	expectedFiles := []string{"cyclic.proto", "c/types.proto", "a/models.proto"}
+	checkSymbolicReferences(t, "cyclic", inputFiles, expectedFiles, nil)
+}
+
+func TestFileDescriptorGeneratorSymbolicMaps(t *testing.T) {
+	inputFiles := []string{"main.yaml", "models/directory.yaml"}
+	expectedFiles := []string{"maprefs.proto", "directory.proto"}
+	checkSymbolicReferences(t, "maprefs", inputFiles, expectedFiles, nil)
+}
+
+func TestFileDescriptorGeneratorSymbolicValidationRules(t *testing.T) {
+	inputFiles := []string{"main.yaml", "models/users.yaml"}
+	expectedFiles := []string{"validationrefs.proto", "users.proto"}
+	checkSymbolicReferences(t, "validationrefs", inputFiles, expectedFiles, map[string]string{"validation_rules": "true"})
+}
+
+func TestFileDescriptorGeneratorSymbolicOpenAPIAnnotations(t *testing.T) {
+	inputFiles := []string{"main.yaml", "models/pets.yaml"}
+	expectedFiles := []string{"annotationrefs.proto", "pets.proto"}
+	checkSymbolicReferences(t, "annotationrefs", inputFiles, expectedFiles,
+		map[string]string{"openapi_annotations": "true"})
+}
+
+func TestFileDescriptorGeneratorSymbolicGrpcAnnotations(t *testing.T) {
+	inputFiles := []string{"main.yaml", "models/pets.yaml"}
+	// The Go helpers are only written for the converted description.
+	expectedFiles := []string{"grpcrefs.proto", "pets.proto"}
+	checkSymbolicReferences(t, "grpcrefs", inputFiles, expectedFiles, map[string]string{"grpc_annotations": "true"})
+}
+
+// checkSymbolicReferences renders 'main.yaml' of the directory 'directory' inside of testfiles with the package
+// 'directory' and the parameters 'parameters'. The files 'expectedFiles' are compared with the files inside of
+// goldstandard/'directory'.
+func checkSymbolicReferences(t *testing.T, directory string, inputFiles []string, expectedFiles []string,
+	parameters map[string]string) {
+	// Symbolic references have to be URLs or absolute paths, so the descriptions are copied into a temporary directory.
+	dir, err := ioutil.TempDir("", directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range inputFiles {
+		b, err := ioutil.ReadFile(filepath.Join(testFilesDirectory, directory, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFile(filepath.Join(dir, name), []byte(strings.Replace(string(b), "DIRECTORY", dir, -1)))
+	}
+	// The input has to be a relative path, otherwise gnostic treats the description itself as symbolic reference.
+	wd, _ := os.Getwd()
+	input, err := filepath.Rel(wd, filepath.Join(dir, "main.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := prepareRenderer(input, directory, parameters)
+	if err != nil {
+		handleError(err, t)
+		return
+	}
+	response := &plugins.Response{}
+	if err := r.Render(response, directory+".proto"); err != nil {
+		handleError(err, t)
+		return
+	}
+	if len(response.Files) != len(expectedFiles) {
+		t.Fatalf("Expected %d files, got %d", len(expectedFiles), len(response.Files))
+	}
+	for i, f := range response.Files {
+		if f.Name != expectedFiles[i] {
+			t.Errorf("Expected file %s, got %s", expectedFiles[i], f.Name)
+		}
+		checkContents(t, string(f.Data), "goldstandard/"+directory+"/"+expectedFiles[i])
+	}
+}
+
+func TestRenderDescriptorSet(t *testing.T) {
+	input := "testfiles/parameters.yaml"
+
+	r, err := prepareRenderer(input, "parameters", map[string]string{"descriptor_set": "parameters.pb"})
+	if err != nil {
+		handleError(err, t)
+		return
+	}
+	response := &plugins.Response{}
+	if err := r.Render(response, "parameters.proto"); err != nil {
+		handleError(err, t)
+		return
+	}
+	if len(response.Files) != 2 || response.Files[1].Name != "parameters.pb" {
+		t.Fatalf("Expected the files parameters.proto and parameters.pb, got %d files", len(response.Files))
+	}
+
+	fdSet := &dpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(response.Files[1].Data, fdSet); err != nil {
+		t.Fatal(err)
+	}
+	// Like 'protoc --include_imports' the imports come first.
+	expectedFiles := []string{
+		"google/api/http.proto",
+		"google/protobuf/descriptor.proto",
+		"google/api/annotations.proto",
+		"google/protobuf/empty.proto",
+		"parameters.proto",
+	}
+	if len(fdSet.File) != len(expectedFiles) {
+		t.Fatalf("Expected %d files inside of the descriptor set, got %d", len(expectedFiles), len(fdSet.File))
+	}
+	for i, fd := range fdSet.File {
+		if fd.GetName() != expectedFiles[i] {
+			t.Errorf("Expected file %s, got %s", expectedFiles[i], fd.GetName())
+		}
+	}
+
+	// Like 'protoc --include_source_info' the source code info points to the rendered file.
+	mainProto := getLast(fdSet.File)
+	if len(mainProto.GetSourceCodeInfo().GetLocation()) == 0 {
+		t.Fatalf("Expected source code info for parameters.proto")
+	}
+	lines := strings.Split(string(response.Files[0].Data), "\n")
+	for _, location := range mainProto.SourceCodeInfo.Location {
+		if len(location.Path) == 2 && location.Path[0] == serviceFieldNumber {
+			if line := lines[location.Span[0]]; !strings.HasPrefix(line, "service ") {
+				t.Errorf("Expected the span of the service to point to the service, got: %s", line)
+			}
+		}
+	}
+	if !proto.HasExtension(mainProto.Service[0].Method[0].Options, annotations.E_Http) {
+		t.Errorf("Expected the HTTP annotation of the RPC %s", mainProto.Service[0].Method[0].GetName())
+	}
+}
+
+func TestWellKnownDependencies(t *testing.T) {
+	// A message with a field that uses a Google API annotation and a field with a well-known type.
+	fieldBehaviorOptions := &dpb.FieldOptions{}
+	proto.SetExtension(fieldBehaviorOptions, annotations.E_FieldBehavior,
+		[]annotations.FieldBehavior{annotations.FieldBehavior_REQUIRED})
+	message := &dpb.DescriptorProto{
+		Name: proto.String("Event"),
+		Field: []*dpb.FieldDescriptorProto{
+			{
+				Name:     proto.String("name"),
+				Number:   proto.Int32(1),
+				Label:    dpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     dpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				JsonName: proto.String("name"),
+				Options:  fieldBehaviorOptions,
+			},
+			{
+				Name:     proto.String("time"),
+				Number:   proto.Int32(2),
+				Label:    dpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     dpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+				TypeName: proto.String(".google.protobuf.Timestamp"),
+				JsonName: proto.String("time"),
+			},
+		},
+	}
+	mainProto := &dpb.FileDescriptorProto{
+		Name:        proto.String("events.proto"),
+		Package:     proto.String("events"),
+		Syntax:      proto.String("proto3"),
+		MessageType: []*dpb.DescriptorProto{message},
+	}
+	fdSet := &dpb.FileDescriptorSet{File: []*dpb.FileDescriptorProto{mainProto}}
+	if err := buildDependencies(fdSet); err != nil {
+		t.Fatal(err)
+	}
+	addDependencies(fdSet)
+
+	expectedDependencies := []string{"google/api/field_behavior.proto", "google/protobuf/timestamp.proto"}
+	if strings.Join(mainProto.Dependency, ",") != strings.Join(expectedDependencies, ",") {
+		t.Errorf("Expected the imports %s, got %s", expectedDependencies, mainProto.Dependency)
+	}
+	f, err := NewRenderer(nil).RenderProto(fdSet, "events.proto")
+	if err != nil {
+		handleError(err, t)
+		return
+	}
+	if !strings.Contains(string(f.Data), "(google.api.field_behavior) = REQUIRED") {
+		t.Errorf("Expected the field behavior to be rendered, got:\n%s", f.Data)
+	}
+}
+
+func TestRenderProtoValidation(t *testing.T) {
+	// Two fields with the same number are not caught by protoreflect, but by protodesc.
+	mainProto := &dpb.FileDescriptorProto{
+		Name:    proto.String("invalid.proto"),
+		Package: proto.String("invalid"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*dpb.DescriptorProto{{
+			Name: proto.String("Book"),
+			Field: []*dpb.FieldDescriptorProto{
+				{
+					Name:     proto.String("name"),
+					Number:   proto.Int32(1),
+					Label:    dpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     dpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					JsonName: proto.String("name"),
+				},
+				{
+					Name:     proto.String("title"),
+					Number:   proto.Int32(1),
+					Label:    dpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     dpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					JsonName: proto.String("title"),
+				},
+			},
+		}},
+	}
+	fdSet := &dpb.FileDescriptorSet{File: []*dpb.FileDescriptorProto{mainProto}}
+	_, err := NewRenderer(nil).RenderProto(fdSet, "invalid.proto")
+	if err == nil || !strings.Contains(err.Error(), "invalid.Book") {
+		t.Errorf("Expected an error for the conflicting field numbers of invalid.Book, got: %v", err)
+	}
+}
+
+func TestValidateFileDescriptors(t *testing.T) {
+	// The path templates of some operations use variables which are not parameters of the operation.
+	r, err := prepareRenderer("testfiles/parameters.yaml", "parameters", nil)
+	if err != nil {
+		handleError(err, t)
+		return
+	}
+	response := &plugins.Response{}
+	if err := r.Render(response, "parameters.proto"); err != nil {
+		handleError(err, t)
+		return
+	}
+	// The number of warnings by the keys of the operation.
+	expectedWarnings := map[string]int{
+		"#/paths/~1testParameterPath~1{param1}/get":                   1,
+		"#/paths/~1testParameterPathEnum~1{param1}/get":               1,
+		"#/paths/~1testParameterMultiplePath~1{param1}~1{param2}/get": 2,
+	}
+	for _, msg := range response.Messages {
+		if msg.Code != "HTTPRULE" || msg.Level != plugins.Message_WARNING || expectedWarnings[keyPath(msg.Keys)] == 0 {
+			t.Errorf("Unexpected message %s: %s", keyPath(msg.Keys), msg.Text)
+		}
+		expectedWarnings[keyPath(msg.Keys)]--
+	}
+	for keys, count := range expectedWarnings {
+		if count > 0 {
+			t.Errorf("Expected %d more warnings for the path variables of %s", count, keys)
+		}
+	}
+
+	// A field with an unknown type and a field with a duplicate number.
+	r = NewRenderer(nil)
+	field1 := &dpb.FieldDescriptorProto{
+		Name:     proto.String("author"),
+		Number:   proto.Int32(1),
+		Label:    dpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:     dpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+		TypeName: proto.String("library.Author"),
+	}
+	field2 := &dpb.FieldDescriptorProto{
+		Name:   proto.String("title"),
+		Number: proto.Int32(1),
+		Label:  dpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:   dpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+	}
+	message := &dpb.DescriptorProto{Name: proto.String("Book"), Field: []*dpb.FieldDescriptorProto{field1, field2}}
+	r.setOrigin(message, []string{"components", "schemas", "Book"})
+	r.setOrigin(field1, []string{"components", "schemas", "Book", "properties", "author"})
+	r.FdSet = &dpb.FileDescriptorSet{File: []*dpb.FileDescriptorProto{{
+		Name:        proto.String("library.proto"),
+		Package:     proto.String("library"),
+		Syntax:      proto.String("proto3"),
+		MessageType: []*dpb.DescriptorProto{message},
+	}}}
+	err = r.validateFileDescriptors(&plugins.Response{})
+	validationError, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Expected a validation error, got: %v", err)
+	}
+	expectedProblems := []string{
+		"#/components/schemas/Book/properties/author: The field 'author' of the message 'library.Book' has the type " +
+			"'library.Author', which can't be resolved",
+		"#/components/schemas/Book: The field 'title' of the message 'library.Book' has the same number as the field " +
+			"'author'",
+	}
+	if len(validationError.Problems) != len(expectedProblems) {
+		t.Fatalf("Expected %d problems, got:\n%s", len(expectedProblems), err)
+	}
+	for i, problem := range validationError.Problems {
+		if problem.String() != expectedProblems[i] {
+			t.Errorf("Expected the problem %q, got %q", expectedProblems[i], problem.String())
+		}
+	}
+}
 
-	for _, errorInput := range erroneousInput {
-		errorMessages := map[string]bool{
-			"cycle in imports: cyclic_dependency_2.proto -> cyclic_dependency_1.proto -> cyclic_dependency_2.proto": true,
+func TestCreateOpenAPIDocFromGnosticOutput(t *testing.T) {
+	// The encoding of the document ends with the newline of the description of the last tag.
+	document := &openapiv3.Document{
+		Openapi: "3.0.0",
+		Info:    &openapiv3.Info{Title: "Pets", Version: "1.0.0"},
+		Tags:    []*openapiv3.Tag{{Name: "pets", Description: "Everything about pets\n"}},
+	}
+	b, err := proto.Marshal(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b[len(b)-1] != '\n' {
+		t.Fatalf("Expected the encoding of the document to end with a newline")
+	}
+	// Older versions of gnostic append a newline to the output.
+	for _, output := range [][]byte{b, append(b, '\n')} {
+		parsed, err := createOpenAPIDocFromGnosticOutput(output)
+		if err != nil {
+			t.Fatal(err)
 		}
-		protoData, err = runGeneratorWithoutEnvironment(errorInput, "cyclic_dependency_1")
-		if _, ok := errorMessages[err.Error()]; !ok {
-			// If we don't get an error from the generator the test fails!
-			handleError(err, t)
+		if !proto.Equal(document, parsed) {
+			t.Errorf("Expected the document %v, got %v", document, parsed)
 		}
 	}
 }
 
 func runGeneratorWithoutEnvironment(input string, packageName string) ([]byte, error) {
-	surfaceModel, err := buildSurfaceModel(input)
+	return runGeneratorWithParameters(input, packageName, nil)
+}
+
+func runGeneratorWithParameters(input string, packageName string, parameters map[string]string) ([]byte, error) {
+	r, err := prepareRenderer(input, packageName, parameters)
 	if err != nil {
 		return nil, err
 	}
-	NewProtoLanguageModel().Prepare(surfaceModel, "openapi.v3.Document")
-	r := NewRenderer(surfaceModel)
-	r.Package = packageName
-
 	fdSet, err := r.runFileDescriptorSetGenerator()
 	r.FdSet = fdSet
 	if err != nil {
 		return nil, err
 	}
+	if err := r.validateFileDescriptors(&plugins.Response{}); err != nil {
+		return nil, err
+	}
 	f, err := r.RenderProto(fdSet, "")
 	if err != nil {
 		return nil, err
@@ -110,6 +688,35 @@ func runGeneratorWithoutEnvironment(input string, packageName string) ([]byte, e
 	return f.Data, err
 }
 
+// prepareRenderer builds the surface model for 'input', prepares it with the language model and returns a renderer
+// with the options set according to 'parameters'.
+func prepareRenderer(input string, packageName string, parameters map[string]string) (*Renderer, error) {
+	documentv3, err := ParseOpenAPIDoc(input)
+	if err != nil {
+		return nil, err
+	}
+	surfaceModel, err := surface.NewModelFromOpenAPI3(documentv3, input)
+	if err != nil {
+		return nil, err
+	}
+	languageModel := NewProtoLanguageModel()
+	languageModel.Document = documentv3
+	r := NewRenderer(surfaceModel)
+	r.Package = packageName
+	r.Document = documentv3
+
+	pluginParameters := make([]*plugins.Parameter, 0)
+	for name, value := range parameters {
+		pluginParameters = append(pluginParameters, &plugins.Parameter{Name: name, Value: value})
+	}
+	err = applyParameters(pluginParameters, languageModel, r)
+	if err != nil {
+		return nil, err
+	}
+	languageModel.Prepare(surfaceModel, "openapi.v3.Document")
+	return r, nil
+}
+
 func buildSurfaceModel(input string) (*surface.Model, error) {
 	documentv3, err := ParseOpenAPIDoc(input)
 	if err != nil {
@@ -148,10 +755,6 @@ func checkContents(t *testing.T, actualContents string, goldenFileName string) {
 
 func handleError(err error, t *testing.T) {
 	t.Errorf("Error while executing the protoc-generator")
-	if strings.Contains(err.Error(), "included an unresolvable reference") {
-		t.Errorf("This could be due to the fact that 'typeName' is set wrong on a FieldDescriptorProto." +
-			"For every FieldDescriptorProto where the type == 'FieldDescriptorProto_TYPE_MESSAGE' the correct typeName needs to be set.")
-	}
 	t.Errorf(err.Error())
 }
 
@@ -0,0 +1,192 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	openapigenerator "github.com/google/gnostic/cmd/protoc-gen-openapi/generator"
+	openapiv3 "github.com/google/gnostic/openapiv3"
+	plugins "github.com/google/gnostic/plugins"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	dpb "google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+func TestRoundTrip(t *testing.T) {
+	input := "testfiles/roundtrip.yaml"
+
+	original, err := ParseOpenAPIDoc(input)
+	if err != nil {
+		t.Fatalf("Error while parsing input file: %s", input)
+	}
+	roundTripped, err := runRoundTrip(input, "roundtrip")
+	if err != nil {
+		handleError(err, t)
+		return
+	}
+	checkRoundTrip(t, original, roundTripped)
+}
+
+// runRoundTrip converts the OpenAPI description 'input' into a .proto file with the options of gnostic's
+// openapiv3/annotations.proto and converts the file back into an OpenAPI description with protoc-gen-openapi.
+func runRoundTrip(input string, packageName string) (*openapiv3.Document, error) {
+	r, err := prepareRenderer(input, packageName, map[string]string{
+		"openapi_annotations": "true",
+		"descriptor_set":      packageName + ".pb",
+	})
+	if err != nil {
+		return nil, err
+	}
+	response := &plugins.Response{}
+	if err := r.Render(response, packageName+".proto"); err != nil {
+		return nil, err
+	}
+	fdSet := &dpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(response.Files[len(response.Files)-1].Data, fdSet); err != nil {
+		return nil, err
+	}
+
+	// protoc-gen-openapi doesn't generate Go code, but protogen needs a Go import path for every file.
+	importPaths := make([]string, 0)
+	for _, fd := range fdSet.File {
+		importPaths = append(importPaths, "M"+fd.GetName()+"=example.com/"+strings.TrimSuffix(fd.GetName(), ".proto"))
+	}
+	request := &pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{packageName + ".proto"},
+		Parameter:      proto.String(strings.Join(importPaths, ",")),
+		ProtoFile:      fdSet.File,
+	}
+	plugin, err := protogen.Options{}.New(request)
+	if err != nil {
+		return nil, err
+	}
+	circularDepth := 2
+	conf := openapigenerator.Configuration{
+		Version:         proto.String("0.0.1"),
+		Title:           proto.String(""),
+		Description:     proto.String(""),
+		Naming:          proto.String("json"),
+		FQSchemaNaming:  proto.Bool(false),
+		EnumType:        proto.String("integer"),
+		CircularDepth:   &circularDepth,
+		DefaultResponse: proto.Bool(false),
+	}
+	if err := openapigenerator.NewOpenAPIv3Generator(plugin, conf).Run(); err != nil {
+		return nil, err
+	}
+	files := plugin.Response().GetFile()
+	if len(files) != 1 {
+		return nil, errors.New("protoc-gen-openapi didn't generate an OpenAPI description")
+	}
+	return openapiv3.ParseDocument([]byte(files[0].GetContent()))
+}
+
+// checkRoundTrip checks that the information of 'original' that is rendered as options of gnostic's
+// openapiv3/annotations.proto is preserved by 'roundTripped'. protoc-gen-openapi adds a tag for every service, so the
+// tags of 'original' only need to be contained.
+func checkRoundTrip(t *testing.T, original *openapiv3.Document, roundTripped *openapiv3.Document) {
+	check := func(element string, expected proto.Message, actual proto.Message) {
+		if !proto.Equal(expected, actual) {
+			t.Errorf("The round-trip changed %s: expected %v, got %v", element, expected, actual)
+		}
+	}
+	check("'info'", original.Info, roundTripped.Info)
+	check("'externalDocs'", original.ExternalDocs, roundTripped.ExternalDocs)
+	check("'securitySchemes'", original.Components.GetSecuritySchemes(), roundTripped.Components.GetSecuritySchemes())
+	check("'servers'", &openapiv3.Document{Servers: original.Servers}, &openapiv3.Document{Servers: roundTripped.Servers})
+	check("'security'", &openapiv3.Document{Security: original.Security},
+		&openapiv3.Document{Security: roundTripped.Security})
+	checkContainedTags(t, "'tags'", tagNames(original.Tags), tagNames(roundTripped.Tags))
+
+	for _, pair := range original.Paths.Path {
+		operations, operationTypes := getValidOperations(pair.Value)
+		for i, operation := range operations {
+			element := operationTypes[i] + " " + pair.Name
+			actual := findOperation(roundTripped, pair.Name, operationTypes[i])
+			if actual == nil {
+				t.Errorf("The round-trip lost the operation %s", element)
+				continue
+			}
+			check("the operationId of "+element, &openapiv3.Operation{OperationId: operation.OperationId},
+				&openapiv3.Operation{OperationId: actual.OperationId})
+			check("the summary of "+element, &openapiv3.Operation{Summary: operation.Summary},
+				&openapiv3.Operation{Summary: actual.Summary})
+			check("the description of "+element, &openapiv3.Operation{Description: operation.Description},
+				&openapiv3.Operation{Description: actual.Description})
+			check("the externalDocs of "+element, operation.ExternalDocs, actual.ExternalDocs)
+			check("the security of "+element, &openapiv3.Operation{Security: operation.Security},
+				&openapiv3.Operation{Security: actual.Security})
+			checkContainedTags(t, "the tags of "+element, operation.Tags, actual.Tags)
+		}
+	}
+
+	for _, pair := range original.Components.GetSchemas().GetAdditionalProperties() {
+		expected := pair.Value.GetSchema()
+		actual := findSchema(roundTripped, pair.Name)
+		if actual == nil {
+			t.Errorf("The round-trip lost the schema %s", pair.Name)
+			continue
+		}
+		check("the schema "+pair.Name, annotatedSchema(expected), annotatedSchema(actual))
+		for _, property := range expected.GetProperties().GetAdditionalProperties() {
+			actualProperty := findProperty(actual, property.Name)
+			if actualProperty == nil {
+				t.Errorf("The round-trip lost the property %s of the schema %s", property.Name, pair.Name)
+				continue
+			}
+			check("the property "+property.Name+" of the schema "+pair.Name, annotatedSchema(property.Value.GetSchema()),
+				annotatedSchema(actualProperty))
+		}
+	}
+}
+
+// checkContainedTags checks that the round-trip kept every tag of 'expected'.
+func checkContainedTags(t *testing.T, element string, expected []string, actual []string) {
+	for _, tag := range expected {
+		if !isDuplicate(actual, tag) {
+			t.Errorf("The round-trip lost the tag %s of %s: got %v", tag, element, actual)
+		}
+	}
+}
+
+func tagNames(tags []*openapiv3.Tag) []string {
+	names := make([]string, 0)
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+func findSchema(document *openapiv3.Document, name string) *openapiv3.Schema {
+	for _, pair := range document.Components.GetSchemas().GetAdditionalProperties() {
+		if pair.Name == name {
+			return pair.Value.GetSchema()
+		}
+	}
+	return nil
+}
+
+func findProperty(schema *openapiv3.Schema, name string) *openapiv3.Schema {
+	for _, pair := range schema.GetProperties().GetAdditionalProperties() {
+		if pair.Name == name {
+			return pair.Value.GetSchema()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,413 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	nethttp "net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	openapiv3 "github.com/google/gnostic/openapiv3"
+)
+
+// schemaIndex maps the names of surface model types and fields to the OpenAPI schemas they were built from. The
+// surface model drops a couple of information (e.g.: nested arrays), with the index this information can be recovered.
+type schemaIndex struct {
+	// Maps the name of a type to the object schema the type was built from.
+	types map[string]*openapiv3.Schema
+	// Maps the name of a type and the name of one of its fields to the schema the field was built from.
+	fields map[string]map[string]*openapiv3.Schema
+	// The names of all components (schemas, parameters, responses and request bodies) of the document.
+	components map[string]bool
+	// Maps the name of a type and the name of one of its fields to the symbolic reference (a reference to another
+	// OpenAPI description) the field was built from.
+	references map[string]map[string]string
+	// Maps the name of a type to the keys of the OpenAPI element it was built from (e.g.: components, schemas, Book).
+	typeKeys map[string][]string
+	// Maps the name of a type and the name of one of its fields to the keys of the OpenAPI element the field was built
+	// from.
+	fieldKeys map[string]map[string][]string
+	// Maps the name of a type and the name of one of its fields to the parameter the field was built from.
+	parameters map[string]map[string]*openapiv3.Parameter
+}
+
+// newSchemaIndex walks 'document' the same way gnostic builds the surface model
+// (see: github.com/google/gnostic/surface/model_openapiv3.go) and indexes every schema that becomes a type or field.
+func newSchemaIndex(document *openapiv3.Document) *schemaIndex {
+	index := &schemaIndex{
+		types:      make(map[string]*openapiv3.Schema),
+		fields:     make(map[string]map[string]*openapiv3.Schema),
+		components: make(map[string]bool),
+		references: make(map[string]map[string]string),
+		typeKeys:   make(map[string][]string),
+		fieldKeys:  make(map[string]map[string][]string),
+		parameters: make(map[string]map[string]*openapiv3.Parameter),
+	}
+	if document == nil {
+		return index
+	}
+
+	components := document.GetComponents()
+	for _, pair := range components.GetSchemas().GetAdditionalProperties() {
+		keys := []string{"components", "schemas", pair.Name}
+		index.components[pair.Name] = true
+		index.addKeys(pair.Name, keys)
+		index.addSchemaOrReference(pair.Name, pair.Value, keys)
+		if schema := pair.Value.GetSchema(); schema != nil && !isObjectSchema(schema) {
+			// Primitive schemas get wrapped into a type with a single field named 'value'.
+			index.add(pair.Name, "value", schema, keys)
+		}
+	}
+	for _, pair := range components.GetParameters().GetAdditionalProperties() {
+		keys := []string{"components", "parameters", pair.Name}
+		index.components[pair.Name] = true
+		index.addKeys(pair.Name, keys)
+		index.addParameter(pair.Name, pair.Value.GetParameter(), keys)
+	}
+	for _, pair := range components.GetResponses().GetAdditionalProperties() {
+		keys := []string{"components", "responses", pair.Name}
+		index.components[pair.Name] = true
+		index.addKeys(pair.Name, keys)
+		index.addContent(pair.Name, pair.Value.GetResponse().GetContent(), keys)
+	}
+	for _, pair := range components.GetRequestBodies().GetAdditionalProperties() {
+		keys := []string{"components", "requestBodies", pair.Name}
+		index.components[pair.Name] = true
+		index.addKeys(pair.Name, keys)
+		index.addContent(pair.Name, pair.Value.GetRequestBody().GetContent(), keys)
+	}
+
+	for _, pair := range document.GetPaths().GetPath() {
+		operations, operationTypes := getValidOperations(pair.Value)
+		for i, operation := range operations {
+			name := operationName(operation.OperationId, operationTypes[i], pair.Name)
+			keys := []string{"paths", pair.Name, operationTypes[i]}
+			index.addKeys(name+"Parameters", append(copyKeys(keys), "parameters"))
+			for j, parameter := range operation.Parameters {
+				parameterKeys := append(copyKeys(keys), "parameters", strconv.Itoa(j))
+				index.addParameter(name+"Parameters", parameter.GetParameter(), parameterKeys)
+				if reference := parameter.GetReference(); reference != nil {
+					// gnostic names fields of referenced parameters after the referenced component.
+					index.addReference(name+"Parameters", referenceName(reference.XRef), reference.XRef)
+					index.add(name+"Parameters", referenceName(reference.XRef), nil, parameterKeys)
+					index.setParameter(name+"Parameters", referenceName(reference.XRef),
+						findParameter(document, reference.XRef))
+				}
+			}
+			// Unlike the parameters type, gnostic names the types of request bodies and responses after the plain
+			// operationId.
+			if requestBody := operation.RequestBody.GetRequestBody(); requestBody != nil {
+				requestBodyKeys := append(copyKeys(keys), "requestBody")
+				index.addKeys(operation.OperationId+"RequestBody", requestBodyKeys)
+				index.addContent(operation.OperationId+"RequestBody", requestBody.Content, requestBodyKeys)
+			}
+			for _, response := range operation.GetResponses().GetResponseOrReference() {
+				responseKeys := append(copyKeys(keys), "responses", response.Name)
+				index.addKeys(operation.OperationId+statusCodeText(response.Name), responseKeys)
+				index.addContent(operation.OperationId+statusCodeText(response.Name), response.Value.GetResponse().GetContent(),
+					responseKeys)
+			}
+			if defaultResponse := operation.GetResponses().GetDefault(); defaultResponse != nil {
+				responseKeys := append(copyKeys(keys), "responses", "default")
+				index.addKeys(operation.OperationId+"Default", responseKeys)
+				index.addContent(operation.OperationId+"Default", defaultResponse.GetResponse().GetContent(), responseKeys)
+			}
+		}
+	}
+	return index
+}
+
+// lookup returns the schema for the field 'fieldName' of the type 'typeName' or nil if there is no such schema.
+func (index *schemaIndex) lookup(typeName string, fieldName string) *openapiv3.Schema {
+	if fields, ok := index.fields[typeName]; ok {
+		return fields[fieldName]
+	}
+	return nil
+}
+
+// lookupParameter returns the parameter the field 'fieldName' of the type 'typeName' was built from or nil if the
+// field was not built from a parameter.
+func (index *schemaIndex) lookupParameter(typeName string, fieldName string) *openapiv3.Parameter {
+	return index.parameters[typeName][fieldName]
+}
+
+// isComponent checks whether the type 'typeName' was built from a component of the document.
+func (index *schemaIndex) isComponent(typeName string) bool {
+	return index.components[typeName]
+}
+
+// isInline checks whether the type 'typeName' was built from an inline object schema, which is not a component.
+func (index *schemaIndex) isInline(typeName string) bool {
+	_, ok := index.types[typeName]
+	return ok && !index.isComponent(typeName)
+}
+
+// lookupReference returns the symbolic reference the field 'fieldName' of the type 'typeName' was built from or an empty
+// string if the field was not built from a symbolic reference.
+func (index *schemaIndex) lookupReference(typeName string, fieldName string) string {
+	if references, ok := index.references[typeName]; ok {
+		return references[fieldName]
+	}
+	return ""
+}
+
+// lookupType returns the object schema for the type 'typeName' or nil if there is no such schema.
+func (index *schemaIndex) lookupType(typeName string) *openapiv3.Schema {
+	return index.types[typeName]
+}
+
+// lookupKeys returns the keys of the OpenAPI element the field 'fieldName' of the type 'typeName' was built from. If the
+// field is not known, the keys of the type are returned. If 'fieldName' is empty, the keys of the type are returned.
+func (index *schemaIndex) lookupKeys(typeName string, fieldName string) []string {
+	if keys, ok := index.fieldKeys[typeName][fieldName]; ok {
+		return keys
+	}
+	return index.typeKeys[typeName]
+}
+
+// addKeys adds 'keys' as keys of the type 'typeName', if the type has no keys yet.
+func (index *schemaIndex) addKeys(typeName string, keys []string) {
+	if _, ok := index.typeKeys[typeName]; !ok {
+		index.typeKeys[typeName] = keys
+	}
+}
+
+// add adds 'schema' as field 'fieldName' of the type 'typeName' to the index. 'keys' are the keys of the OpenAPI element
+// the field is built from, they are added even if there is no schema (e.g.: for references).
+func (index *schemaIndex) add(typeName string, fieldName string, schema *openapiv3.Schema, keys []string) {
+	if _, ok := index.fieldKeys[typeName]; !ok {
+		index.fieldKeys[typeName] = make(map[string][]string)
+	}
+	index.fieldKeys[typeName][fieldName] = keys
+	if schema == nil {
+		return
+	}
+	if _, ok := index.fields[typeName]; !ok {
+		index.fields[typeName] = make(map[string]*openapiv3.Schema)
+	}
+	index.fields[typeName][fieldName] = schema
+}
+
+// addReference adds 'reference' as symbolic reference of the field 'fieldName' of the type 'typeName', if it points to
+// another OpenAPI description. References inside of the document itself start with '#'.
+func (index *schemaIndex) addReference(typeName string, fieldName string, reference string) {
+	if reference == "" || strings.HasPrefix(reference, "#") {
+		return
+	}
+	if _, ok := index.references[typeName]; !ok {
+		index.references[typeName] = make(map[string]string)
+	}
+	index.references[typeName][fieldName] = reference
+}
+
+// addParameter adds the schema of 'parameter' as field of the type 'typeName'. 'keys' are the keys of the parameter.
+func (index *schemaIndex) addParameter(typeName string, parameter *openapiv3.Parameter, keys []string) {
+	if parameter == nil {
+		return
+	}
+	index.setParameter(typeName, parameter.Name, parameter)
+	schemaKeys := append(copyKeys(keys), "schema")
+	index.add(typeName, parameter.Name, parameter.Schema.GetSchema(), schemaKeys)
+	index.addSchemaOrReference(parameter.Name, parameter.Schema, schemaKeys)
+}
+
+// setParameter records that the field 'fieldName' of the type 'typeName' was built from 'parameter'.
+func (index *schemaIndex) setParameter(typeName string, fieldName string, parameter *openapiv3.Parameter) {
+	if parameter == nil {
+		return
+	}
+	if _, ok := index.parameters[typeName]; !ok {
+		index.parameters[typeName] = make(map[string]*openapiv3.Parameter)
+	}
+	index.parameters[typeName][fieldName] = parameter
+}
+
+// addContent adds the schemas of all media types of 'content' as fields of the type 'typeName'. 'keys' are the keys of
+// the element that contains 'content' (e.g.: a response).
+func (index *schemaIndex) addContent(typeName string, content *openapiv3.MediaTypes, keys []string) {
+	for _, pair := range content.GetAdditionalProperties() {
+		schemaOrReference := pair.Value.GetSchema()
+		schemaKeys := append(copyKeys(keys), "content", pair.Name, "schema")
+		index.add(typeName, pair.Name, schemaOrReference.GetSchema(), schemaKeys)
+		index.addSchemaOrReference(typeName+pair.Name, schemaOrReference, schemaKeys)
+	}
+}
+
+// addSchemaOrReference adds all properties of the schema to the index. References are not followed, since they are
+// indexed by their own name. 'keys' are the keys of the schema.
+func (index *schemaIndex) addSchemaOrReference(typeName string, schemaOrReference *openapiv3.SchemaOrReference, keys []string) {
+	schema := schemaOrReference.GetSchema()
+	if schema == nil {
+		return
+	}
+
+	switch schema.Type {
+	case "", "object":
+		if _, ok := index.types[typeName]; !ok {
+			index.types[typeName] = schema
+		}
+		index.addKeys(typeName, keys)
+		for _, pair := range schema.GetProperties().GetAdditionalProperties() {
+			propertyKeys := append(copyKeys(keys), "properties", pair.Name)
+			index.add(typeName, pair.Name, pair.Value.GetSchema(), propertyKeys)
+			index.addReference(typeName, pair.Name, itemsReference(pair.Value))
+			index.addSchemaOrReference(pair.Name, pair.Value, propertyKeys)
+		}
+		if additionalProperties := schema.AdditionalProperties.GetSchemaOrReference(); additionalProperties != nil {
+			additionalKeys := append(copyKeys(keys), "additionalProperties")
+			index.add(typeName, "additional_properties", additionalProperties.GetSchema(), additionalKeys)
+			index.addSchemaOrReference(typeName+"AdditionalProperties", additionalProperties, additionalKeys)
+		}
+		// The fields of inline schemas of 'allOf', 'anyOf' and 'oneOf' are added to the current type.
+		for i, schemaOrRefs := range [][]*openapiv3.SchemaOrReference{schema.AnyOf, schema.OneOf, schema.AllOf} {
+			for j, schemaOrRef := range schemaOrRefs {
+				index.addSchemaOrReference(typeName, schemaOrRef,
+					append(copyKeys(keys), []string{"anyOf", "oneOf", "allOf"}[i], strconv.Itoa(j)))
+			}
+		}
+	case "array":
+		for _, schemaOrRef := range schema.GetItems().GetSchemaOrReference() {
+			index.addSchemaOrReference(typeName, schemaOrRef, append(copyKeys(keys), "items"))
+		}
+	}
+}
+
+// itemsReference returns the reference of 'schemaOrReference' or, if it is an array, the reference of its items.
+func itemsReference(schemaOrReference *openapiv3.SchemaOrReference) string {
+	for schemaOrReference.GetSchema().GetType() == "array" {
+		items := schemaOrReference.GetSchema().GetItems().GetSchemaOrReference()
+		if len(items) == 0 {
+			return ""
+		}
+		schemaOrReference = items[0]
+	}
+	return schemaOrReference.GetReference().GetXRef()
+}
+
+// referenceName returns the name of the component a reference points to (e.g.: 'Pet' for
+// 'https://example.com/models.yaml#/components/schemas/Pet').
+func referenceName(reference string) string {
+	parts := strings.Split(reference, "/")
+	name, err := url.QueryUnescape(parts[len(parts)-1])
+	if err != nil {
+		return parts[len(parts)-1]
+	}
+	return name
+}
+
+// isObjectSchema checks whether 'schema' is rendered as message.
+func isObjectSchema(schema *openapiv3.Schema) bool {
+	return schema.Type == "" || schema.Type == "object"
+}
+
+// arrayDepth returns how deep arrays are nested inside of 'schema'. A schema that is not an array has a depth of zero.
+// Only inline schemas are considered.
+func arrayDepth(schema *openapiv3.Schema) int {
+	depth := 0
+	for schema != nil && schema.Type == "array" {
+		depth++
+		items := schema.GetItems().GetSchemaOrReference()
+		if len(items) == 0 {
+			break
+		}
+		schema = items[0].GetSchema()
+	}
+	return depth
+}
+
+// getSpecificationExtension returns the value of the specification extension 'name' of 'schema' or an empty string.
+func getSpecificationExtension(schema *openapiv3.Schema, name string) string {
+	for _, extension := range schema.GetSpecificationExtension() {
+		if extension.Name == name {
+			return strings.TrimSpace(extension.GetValue().GetYaml())
+		}
+	}
+	return ""
+}
+
+// findOperation returns the operation of 'document' with the path 'path' and the HTTP method 'method' or nil if there is
+// no such operation.
+func findOperation(document *openapiv3.Document, path string, method string) *openapiv3.Operation {
+	for _, pair := range document.GetPaths().GetPath() {
+		if pair.Name != path {
+			continue
+		}
+		operations, operationTypes := getValidOperations(pair.Value)
+		for i, operation := range operations {
+			if operationTypes[i] == strings.ToLower(method) {
+				return operation
+			}
+		}
+	}
+	return nil
+}
+
+// findParameter returns the parameter component of 'document' that 'reference' points to (e.g.:
+// '#/components/parameters/PageSize') or nil.
+func findParameter(document *openapiv3.Document, reference string) *openapiv3.Parameter {
+	if !strings.HasPrefix(reference, "#/components/parameters/") {
+		return nil
+	}
+	for _, pair := range document.GetComponents().GetParameters().GetAdditionalProperties() {
+		if pair.Name == referenceName(reference) {
+			return pair.Value.GetParameter()
+		}
+	}
+	return nil
+}
+
+// findTagDescription returns the description of the tag 'name' of 'document' or an empty string.
+func findTagDescription(document *openapiv3.Document, name string) string {
+	for _, tag := range document.GetTags() {
+		if tag.Name == name {
+			return tag.Description
+		}
+	}
+	return ""
+}
+
+// operationName returns the name gnostic uses for the surface model method of an operation.
+func operationName(operationID string, method string, path string) string {
+	if operationID != "" {
+		name := strings.Title(operationID)
+		return strings.Replace(name, ".", "_", -1)
+	}
+	filteredPath := strings.Replace(path, "/", "_", -1)
+	filteredPath = strings.Replace(filteredPath, ".", "_", -1)
+	filteredPath = strings.Replace(filteredPath, "{", "", -1)
+	filteredPath = strings.Replace(filteredPath, "}", "", -1)
+	return strings.Title(strings.ToUpper(method)) + filteredPath
+}
+
+// statusCodeText returns the text gnostic appends to the name of a response type.
+func statusCodeText(statusCode string) string {
+	code, err := strconv.Atoi(statusCode)
+	if err != nil {
+		return ""
+	}
+	text := nethttp.StatusText(code)
+	if text == "" {
+		return "unknownStatusCode"
+	}
+	return strings.Replace(text, " ", "_", -1)
+}
+
+// isMessageOrFieldSchema checks whether the schema with the keys 'keys' is rendered as message or field. The schemas of
+// items and additional properties are not, they only determine the type of a field.
+func isMessageOrFieldSchema(keys []string) bool {
+	n := len(keys)
+	return n > 0 && keys[n-1] != "items" && keys[n-1] != "additionalProperties"
+}
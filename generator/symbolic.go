@@ -0,0 +1,476 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	openapiv3 "github.com/google/gnostic/openapiv3"
+	surface_v1 "github.com/google/gnostic/surface"
+	"google.golang.org/protobuf/proto"
+	dpb "google.golang.org/protobuf/types/descriptorpb"
+)
+
+// symbolicDocument is an external OpenAPI description that is referenced by a symbolic reference.
+type symbolicDocument struct {
+	location     string
+	document     *openapiv3.Document
+	surfaceModel *surface_v1.Model
+	// The locations of the descriptions this description references.
+	references []string
+}
+
+// generateSymbolicFiles generates the .proto files of the descriptions 'refs' and of all descriptions they reference in
+// turn. Descriptions that reference each other (directly or through other descriptions) are merged into a single file,
+// since .proto files can't import each other. The files are added to the FileDescriptorSets of the symbolic references
+// of 'renderer', dependencies first.
+func (renderer *Renderer) generateSymbolicFiles(refs []string) error {
+	documents, locations, err := loadSymbolicDocuments(refs)
+	if err != nil {
+		return err
+	}
+	references := make(map[string][]string)
+	for _, location := range locations {
+		references[location] = documents[location].references
+	}
+	if renderer.symbolicBase == nil {
+		renderer.symbolicBase = commonDirectory(locations)
+	}
+
+	for _, component := range stronglyConnectedComponents(locations, references) {
+		fileName, packageName := symbolicReferencePath(component[0], renderer.symbolicBase)
+		for _, location := range component {
+			generatedSymbolicReferences[location] = packageName
+		}
+
+		fdSets := make([]*dpb.FileDescriptorSet, 0)
+		for i, location := range component {
+			// While a description of a cycle is built, the messages of the other descriptions get a temporary package,
+			// so that they can be told apart from its own messages with the same name.
+			for j, other := range component {
+				generatedSymbolicReferences[other] = documentPackage(packageName, j, i)
+			}
+			fdSet, err := renderer.buildSymbolicFile(documents[location], fileName, packageName)
+			if err != nil {
+				return err
+			}
+			fdSets = append(fdSets, fdSet)
+		}
+		for _, location := range component {
+			generatedSymbolicReferences[location] = packageName
+		}
+		fdSet := mergeSymbolicFiles(fdSets, component, renderer.symbolicBase)
+		renderer.SymbolicFdSets = append(renderer.SymbolicFdSets, fdSet)
+
+		// Files that import this file need the files it depends on as well.
+		files := make([]*dpb.FileDescriptorProto, 0)
+		for _, location := range component {
+			for _, ref := range references[location] {
+				files = appendFiles(files, renderer.symbolicFiles[ref])
+			}
+		}
+		files = append(files, getLast(fdSet.File))
+		for _, location := range component {
+			renderer.symbolicFiles[location] = files
+		}
+	}
+	return nil
+}
+
+// loadSymbolicDocuments parses the descriptions 'refs' and all descriptions they reference in turn. It returns the
+// descriptions by their location together with the sorted locations.
+func loadSymbolicDocuments(refs []string) (map[string]*symbolicDocument, []string, error) {
+	documents := make(map[string]*symbolicDocument)
+	locations := make([]string, 0)
+	queue := append([]string{}, refs...)
+	for len(queue) > 0 {
+		location := queue[0]
+		queue = queue[1:]
+		if _, ok := documents[location]; ok {
+			continue
+		}
+
+		// Construct an OpenAPI document v3 from the standard gnostic output of the symbolic reference.
+		document, err := parseOpenAPIDocument(location)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Create the surface model. Keep in mind that this resolves the references of the symbolic reference again!
+		surfaceModel, err := surface_v1.NewModelFromOpenAPI3(document, location)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		references := make([]string, 0)
+		for _, ref := range sortedSymbolicReferences(surfaceModel) {
+			if ref != location {
+				references = append(references, ref)
+			}
+		}
+		documents[location] = &symbolicDocument{
+			location:     location,
+			document:     document,
+			surfaceModel: surfaceModel,
+			references:   references,
+		}
+		locations = append(locations, location)
+		queue = append(queue, references...)
+	}
+	sort.Strings(locations)
+	return documents, locations, nil
+}
+
+// buildSymbolicFile builds the FileDescriptorSet for the symbolic reference 'document'. The .proto file is named
+// 'fileName' and has the package 'packageName'.
+func (renderer *Renderer) buildSymbolicFile(document *symbolicDocument, fileName string, packageName string) (*dpb.FileDescriptorSet, error) {
+	// Prepare surface model for recursive call. TODO: Keep discovery documents in mind.
+	inputDocumentType := "openapi.v3.Document"
+	if document.document.Openapi == "2.0.0" {
+		inputDocumentType = "openapi.v2.Document"
+	}
+	languageModel := NewProtoLanguageModel()
+	languageModel.Document = document.document
+	languageModel.NamingStrategy = renderer.NamingStrategy
+	languageModel.Prepare(document.surfaceModel, inputDocumentType)
+
+	// Recursively call the generator.
+	recursiveRenderer := renderer.newSymbolicRenderer(document.surfaceModel, document.document)
+	recursiveRenderer.location = document.location
+	recursiveRenderer.Package = packageName
+	recursiveRenderer.fileName = fileName
+	return recursiveRenderer.runFileDescriptorSetGenerator()
+}
+
+// mergeSymbolicFiles merges the FileDescriptorSets 'fdSets' of the descriptions at 'locations', which all have the same
+// package and file name, into a single FileDescriptorSet. Messages and RPCs that are defined equally by several
+// descriptions are only added once. If descriptions define different messages or RPCs with the same name, the ones of
+// the later descriptions are renamed (see documentTypeName). The merged file shares the messages and RPCs with the
+// original files, so that the OpenAPI elements they were built from are kept (see Renderer.origins).
+func mergeSymbolicFiles(fdSets []*dpb.FileDescriptorSet, locations []string, base []string) *dpb.FileDescriptorSet {
+	if len(fdSets) == 1 {
+		return fdSets[0]
+	}
+
+	files := make([]*dpb.FileDescriptorProto, 0)
+	for _, fdSet := range fdSets {
+		files = append(files, getLast(fdSet.File))
+	}
+	renameSymbolicMessages(files, locations, base)
+
+	first := files[0]
+	merged := proto.Clone(first).(*dpb.FileDescriptorProto)
+	merged.MessageType = append([]*dpb.DescriptorProto{}, first.MessageType...)
+	for i, s := range first.Service {
+		merged.Service[i].Method = append([]*dpb.MethodDescriptorProto{}, s.Method...)
+	}
+	dependencies := make([]*dpb.FileDescriptorProto, 0)
+	for i, fdSet := range fdSets {
+		dependencies = appendFiles(dependencies, fdSet.File[:len(fdSet.File)-1])
+		if i == 0 {
+			continue
+		}
+
+		fd := files[i]
+		for _, m := range fd.MessageType {
+			// Messages with the same name are equal, the others have been renamed.
+			if findMessage(merged, m.GetName()) == nil {
+				merged.MessageType = append(merged.MessageType, m)
+			}
+		}
+		for j, s := range fd.Service {
+			existing := findService(merged, s.GetName())
+			if existing == nil {
+				merged.Service = append(merged.Service, s)
+				copyServiceComment(merged, fd, j)
+				continue
+			}
+			taken := make(map[string]bool)
+			for _, m := range existing.Method {
+				taken[m.GetName()] = true
+			}
+			for _, m := range s.Method {
+				if method := findMethod(existing, m.GetName()); method != nil {
+					if proto.Equal(method, m) {
+						continue
+					}
+					m.Name = proto.String(documentTypeName(m.GetName(), locations[i], base, taken))
+				}
+				taken[m.GetName()] = true
+				existing.Method = append(existing.Method, m)
+			}
+		}
+		for _, dependency := range fd.Dependency {
+			if !isDuplicate(merged.Dependency, dependency) {
+				merged.Dependency = append(merged.Dependency, dependency)
+			}
+		}
+	}
+	sort.Strings(merged.Dependency)
+	setSourceCodeSpans(merged)
+	return &dpb.FileDescriptorSet{File: append(dependencies, merged)}
+}
+
+// renameSymbolicMessages gives the messages of 'files', which are built from the descriptions at 'locations' and will
+// be merged, unique names. A message keeps its name if the files before define no message with that name or an equal
+// one. Otherwise it is renamed (see documentTypeName). Since renaming a message changes the messages that reference it,
+// the messages are compared again until no message is renamed anymore. Afterwards the temporary packages of the
+// messages of the other files (see documentPackage) are replaced and the renamed messages are recorded in
+// renamedSymbolicMessages.
+func renameSymbolicMessages(files []*dpb.FileDescriptorProto, locations []string, base []string) {
+	packageName := files[0].GetPackage()
+	names := make([]map[string]string, len(files)) // Maps the original names of the messages of a file to the new ones.
+	for i, fd := range files {
+		names[i] = make(map[string]string)
+		for _, m := range fd.MessageType {
+			names[i][m.GetName()] = m.GetName()
+		}
+	}
+
+	for renamed := true; renamed; {
+		renamed = false
+		taken := make(map[string]bool)
+		for i := range files {
+			for _, name := range names[i] {
+				taken[name] = true
+			}
+		}
+		definitions := make(map[string]*dpb.DescriptorProto)
+		for i, fd := range files {
+			for _, m := range fd.MessageType {
+				name := names[i][m.GetName()]
+				definition := proto.Clone(m).(*dpb.DescriptorProto)
+				definition.Name = nil
+				renameSymbolicTypes([]*dpb.DescriptorProto{definition}, packageName, i, names)
+				if first, ok := definitions[name]; !ok {
+					definitions[name] = definition
+				} else if !proto.Equal(first, definition) {
+					names[i][m.GetName()] = documentTypeName(m.GetName(), locations[i], base, taken)
+					renamed = true
+				}
+			}
+		}
+	}
+
+	for i, fd := range files {
+		renameSymbolicTypes(fd.MessageType, packageName, i, names)
+		for _, s := range fd.Service {
+			for _, m := range s.Method {
+				m.InputType = proto.String(symbolicTypeName(m.GetInputType(), packageName, i, names))
+				m.OutputType = proto.String(symbolicTypeName(m.GetOutputType(), packageName, i, names))
+			}
+		}
+		for _, m := range fd.MessageType {
+			if name := names[i][m.GetName()]; name != m.GetName() {
+				renamedSymbolicMessages[locations[i]+"#"+m.GetName()] = name
+				m.Name = proto.String(name)
+			}
+		}
+	}
+}
+
+// renameSymbolicTypes rewrites the type names of the fields of 'messages' and of their nested types, which belong to
+// the file at 'index' of the merged files (see symbolicTypeName).
+func renameSymbolicTypes(messages []*dpb.DescriptorProto, packageName string, index int, names []map[string]string) {
+	for _, m := range messages {
+		for _, f := range m.Field {
+			if f.TypeName != nil {
+				f.TypeName = proto.String(symbolicTypeName(f.GetTypeName(), packageName, index, names))
+			}
+		}
+		renameSymbolicTypes(m.NestedType, packageName, index, names)
+	}
+}
+
+// symbolicTypeName returns the name of the type 'typeName' that is referenced by the file at 'index' of the merged files
+// with the package 'packageName' after merging. 'names' maps the original names of the messages of each file to the new
+// ones. Unqualified names (of RPCs) and names qualified with 'packageName' refer to the messages of the file itself,
+// names qualified with a temporary package (see documentPackage) to the messages of another file.
+func symbolicTypeName(typeName string, packageName string, index int, names []map[string]string) string {
+	file, name := index, typeName
+	if strings.HasPrefix(typeName, packageName+".") {
+		name = strings.TrimPrefix(typeName, packageName+".")
+	} else if strings.HasPrefix(typeName, packageName+"#") {
+		segments := strings.SplitN(strings.TrimPrefix(typeName, packageName+"#"), ".", 2)
+		if len(segments) != 2 {
+			return typeName
+		}
+		file, _ = strconv.Atoi(segments[0])
+		name = segments[1]
+	} else if strings.Contains(typeName, ".") {
+		return typeName // A message of another package (e.g.: google.protobuf.Empty).
+	}
+
+	segments := strings.SplitN(name, ".", 2)
+	if n, ok := names[file][segments[0]]; ok {
+		segments[0] = n
+	}
+	if !strings.Contains(typeName, ".") {
+		return strings.Join(segments, ".")
+	}
+	return packageName + "." + strings.Join(segments, ".")
+}
+
+// documentPackage returns the package of the messages of the description at 'index' of a cycle, while the description at
+// 'current' is built. The other descriptions get a temporary package (e.g.: 'a.models#1'), which can't clash with the
+// name of a message.
+func documentPackage(packageName string, index int, current int) string {
+	if index == current {
+		return packageName
+	}
+	return packageName + "#" + strconv.Itoa(index)
+}
+
+// documentTypeName returns a name for the message or RPC 'name' of the description at 'location' that is not taken yet.
+// The name is prefixed with the name of the description (e.g.: 'ModelsError' for 'a/models.yaml'). If that is taken as
+// well, the names of the directories are prepended one by one (e.g.: 'AModelsError') relative to the directory 'base',
+// and finally a number is appended. The returned name is marked as taken.
+func documentTypeName(name string, location string, base []string, taken map[string]bool) string {
+	segments := locationSegments(location)
+	if hasPrefix(segments, base) && len(segments) > len(base) {
+		segments = segments[len(base):]
+	}
+	segments[len(segments)-1] = trimExtensions(segments[len(segments)-1])
+
+	prefixed := name
+	for i := len(segments) - 1; i >= 0; i-- {
+		prefixed = protoTypeName(invalidIdentifierCharacters.ReplaceAllString(segments[i], "_")) + prefixed
+		if !taken[prefixed] {
+			break
+		}
+	}
+	return uniqueName(prefixed, taken, "")
+}
+
+// copyServiceComment copies the comment of the service at 'index' of 'fd' to the last service of 'merged'.
+func copyServiceComment(merged *dpb.FileDescriptorProto, fd *dpb.FileDescriptorProto, index int) {
+	for _, location := range fd.GetSourceCodeInfo().GetLocation() {
+		if len(location.Path) == 2 && location.Path[0] == serviceFieldNumber && location.Path[1] == int32(index) &&
+			location.LeadingComments != nil {
+			addComment(merged, []int32{serviceFieldNumber, int32(len(merged.Service) - 1)}, location.GetLeadingComments())
+		}
+	}
+}
+
+// stronglyConnectedComponents returns the strongly connected components of the graph with the nodes 'nodes' and the
+// edges 'edges' (Tarjan's algorithm). A component comes after all components it has edges to. The nodes of a component
+// are sorted.
+func stronglyConnectedComponents(nodes []string, edges map[string][]string) [][]string {
+	components := make([][]string, 0)
+	indices := make(map[string]int)
+	lowLinks := make(map[string]int)
+	onStack := make(map[string]bool)
+	stack := make([]string, 0)
+
+	var visit func(node string)
+	visit = func(node string) {
+		indices[node] = len(indices)
+		lowLinks[node] = indices[node]
+		stack = append(stack, node)
+		onStack[node] = true
+
+		for _, next := range edges[node] {
+			if _, visited := indices[next]; !visited {
+				visit(next)
+				if lowLinks[next] < lowLinks[node] {
+					lowLinks[node] = lowLinks[next]
+				}
+			} else if onStack[next] && indices[next] < lowLinks[node] {
+				lowLinks[node] = indices[next]
+			}
+		}
+
+		if lowLinks[node] == indices[node] {
+			component := make([]string, 0)
+			for {
+				last := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[last] = false
+				component = append(component, last)
+				if last == node {
+					break
+				}
+			}
+			sort.Strings(component)
+			components = append(components, component)
+		}
+	}
+
+	for _, node := range nodes {
+		if _, visited := indices[node]; !visited {
+			visit(node)
+		}
+	}
+	return components
+}
+
+// sortedSymbolicReferences returns the locations of the symbolic references of 'model' without duplicates. gnostic
+// collects the references from a map, they are sorted to get a deterministic output.
+func sortedSymbolicReferences(model *surface_v1.Model) []string {
+	refs := trimAndRemoveDuplicates(model.SymbolicReferences)
+	sort.Strings(refs)
+	return refs
+}
+
+// appendFiles appends the files of 'add' to 'files' that are not already contained.
+func appendFiles(files []*dpb.FileDescriptorProto, add []*dpb.FileDescriptorProto) []*dpb.FileDescriptorProto {
+	for _, fd := range add {
+		if findFile(files, fd.GetName()) == nil {
+			files = append(files, fd)
+		}
+	}
+	return files
+}
+
+// findFile returns the file named 'name' of 'files' or nil.
+func findFile(files []*dpb.FileDescriptorProto, name string) *dpb.FileDescriptorProto {
+	for _, fd := range files {
+		if fd.GetName() == name {
+			return fd
+		}
+	}
+	return nil
+}
+
+// findMessage returns the top-level message named 'name' of 'fd' or nil.
+func findMessage(fd *dpb.FileDescriptorProto, name string) *dpb.DescriptorProto {
+	for _, m := range fd.MessageType {
+		if m.GetName() == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// findService returns the service named 'name' of 'fd' or nil.
+func findService(fd *dpb.FileDescriptorProto, name string) *dpb.ServiceDescriptorProto {
+	for _, s := range fd.Service {
+		if s.GetName() == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// findMethod returns the RPC named 'name' of 's' or nil.
+func findMethod(s *dpb.ServiceDescriptorProto, name string) *dpb.MethodDescriptorProto {
+	for _, m := range s.Method {
+		if m.GetName() == name {
+			return m
+		}
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"math"
+
+	validate "buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate"
+	openapiv3 "github.com/google/gnostic/openapiv3"
+	"google.golang.org/protobuf/proto"
+	dpb "google.golang.org/protobuf/types/descriptorpb"
+)
+
+// setValidationRules sets the buf.validate rules (https://github.com/bufbuild/protovalidate) of 'fd' according to the
+// validation keywords of 'schema', the schema the field was built from. Fields of maps and messages don't get rules.
+// Keep in mind that gnostic doesn't distinguish between a 'minimum' or 'maximum' of 0 and a missing keyword, so those
+// bounds are only rendered if they are exclusive.
+func setValidationRules(fd *dpb.FieldDescriptorProto, schema *openapiv3.Schema) {
+	if schema == nil {
+		return
+	}
+	rules := scalarValidationRules(fd.GetType(), schema)
+	if fd.GetLabel() == dpb.FieldDescriptorProto_LABEL_REPEATED {
+		rules = repeatedValidationRules(fd.GetType(), schema)
+	}
+	if rules == nil {
+		return
+	}
+	if fd.Options == nil {
+		fd.Options = &dpb.FieldOptions{}
+	}
+	proto.SetExtension(fd.Options, validate.E_Field, rules)
+}
+
+// validationRuleKeywords returns the validation keywords of 'schema' for which rules are rendered (see
+// setValidationRules). 'keys' is the key path of 'schema': rules are only rendered for fields and for the items of
+// fields that are arrays, but not for maps.
+func validationRuleKeywords(schema *openapiv3.Schema, keys []string) []string {
+	n := len(keys)
+	switch {
+	case isMessageOrFieldSchema(keys):
+		if schema.Type == "array" {
+			itemType := dpb.FieldDescriptorProto_TYPE_MESSAGE
+			if items := schema.GetItems().GetSchemaOrReference(); len(items) > 0 && items[0].GetSchema() != nil {
+				itemType = schemaFieldType(items[0].GetSchema())
+			}
+			return ruleKeywords(repeatedValidationRules(itemType, schema))
+		}
+		return ruleKeywords(scalarValidationRules(schemaFieldType(schema), schema))
+	case n > 0 && keys[n-1] == "items" && isMessageOrFieldSchema(keys[:n-1]):
+		return ruleKeywords(scalarValidationRules(schemaFieldType(schema), schema))
+	}
+	return nil
+}
+
+// schemaFieldType returns the type of the field that is built from 'schema', if it is a scalar.
+func schemaFieldType(schema *openapiv3.Schema) dpb.FieldDescriptorProto_Type {
+	return protoBufScalarTypes[findNativeType(schema.Type, schema.Format)]
+}
+
+// ruleKeywords returns the validation keywords that 'rules' were built from. The rules of the items of arrays are not
+// considered.
+func ruleKeywords(rules *validate.FieldRules) []string {
+	keywords := make([]string, 0)
+	switch r := rules.GetType().(type) {
+	case *validate.FieldRules_String_:
+		if r.String_.MinLen != nil {
+			keywords = append(keywords, "minLength")
+		}
+		if r.String_.MaxLen != nil {
+			keywords = append(keywords, "maxLength")
+		}
+		if r.String_.Pattern != nil {
+			keywords = append(keywords, "pattern")
+		}
+	case *validate.FieldRules_Int32:
+		keywords = boundKeywords(r.Int32.GreaterThan != nil, r.Int32.LessThan != nil)
+	case *validate.FieldRules_Int64:
+		keywords = boundKeywords(r.Int64.GreaterThan != nil, r.Int64.LessThan != nil)
+	case *validate.FieldRules_Float:
+		keywords = boundKeywords(r.Float.GreaterThan != nil, r.Float.LessThan != nil)
+	case *validate.FieldRules_Double:
+		keywords = boundKeywords(r.Double.GreaterThan != nil, r.Double.LessThan != nil)
+	case *validate.FieldRules_Repeated:
+		if r.Repeated.MinItems != nil {
+			keywords = append(keywords, "minItems")
+		}
+		if r.Repeated.MaxItems != nil {
+			keywords = append(keywords, "maxItems")
+		}
+		if r.Repeated.Unique != nil {
+			keywords = append(keywords, "uniqueItems")
+		}
+	}
+	return keywords
+}
+
+// boundKeywords returns the keywords of a lower bound and an upper bound of numbers, if they are rendered.
+func boundKeywords(lower bool, upper bool) []string {
+	keywords := make([]string, 0)
+	if lower {
+		keywords = append(keywords, "minimum", "exclusiveMinimum")
+	}
+	if upper {
+		keywords = append(keywords, "maximum", "exclusiveMaximum")
+	}
+	return keywords
+}
+
+// repeatedValidationRules returns the rules of an array 'schema' and its items, which have the type 'itemType'. It
+// returns nil, if the schema has no validation keywords.
+func repeatedValidationRules(itemType dpb.FieldDescriptorProto_Type, schema *openapiv3.Schema) *validate.FieldRules {
+	if schema.Type != "array" {
+		return nil
+	}
+	rules := &validate.RepeatedRules{}
+	if schema.MinItems != 0 {
+		rules.MinItems = proto.Uint64(uint64(schema.MinItems))
+	}
+	if schema.MaxItems != 0 {
+		rules.MaxItems = proto.Uint64(uint64(schema.MaxItems))
+	}
+	if schema.UniqueItems {
+		rules.Unique = proto.Bool(true)
+	}
+	if items := schema.GetItems().GetSchemaOrReference(); len(items) > 0 && items[0].GetSchema() != nil {
+		rules.Items = scalarValidationRules(itemType, items[0].GetSchema())
+	}
+	if proto.Size(rules) == 0 {
+		return nil
+	}
+	return &validate.FieldRules{Type: &validate.FieldRules_Repeated{Repeated: rules}}
+}
+
+// scalarValidationRules returns the rules of a field of the type 'fieldType' that was built from 'schema'. It returns
+// nil, if the schema has no validation keywords that apply to the type.
+func scalarValidationRules(fieldType dpb.FieldDescriptorProto_Type, schema *openapiv3.Schema) *validate.FieldRules {
+	switch fieldType {
+	case dpb.FieldDescriptorProto_TYPE_STRING:
+		if rules := stringValidationRules(schema); proto.Size(rules) > 0 {
+			return &validate.FieldRules{Type: &validate.FieldRules_String_{String_: rules}}
+		}
+	case dpb.FieldDescriptorProto_TYPE_INT32:
+		if rules := int32ValidationRules(schema); proto.Size(rules) > 0 {
+			return &validate.FieldRules{Type: &validate.FieldRules_Int32{Int32: rules}}
+		}
+	case dpb.FieldDescriptorProto_TYPE_INT64:
+		if rules := int64ValidationRules(schema); proto.Size(rules) > 0 {
+			return &validate.FieldRules{Type: &validate.FieldRules_Int64{Int64: rules}}
+		}
+	case dpb.FieldDescriptorProto_TYPE_FLOAT:
+		if rules := floatValidationRules(schema); proto.Size(rules) > 0 {
+			return &validate.FieldRules{Type: &validate.FieldRules_Float{Float: rules}}
+		}
+	case dpb.FieldDescriptorProto_TYPE_DOUBLE:
+		if rules := doubleValidationRules(schema); proto.Size(rules) > 0 {
+			return &validate.FieldRules{Type: &validate.FieldRules_Double{Double: rules}}
+		}
+	}
+	return nil
+}
+
+// stringValidationRules returns the rules for the keywords 'minLength', 'maxLength', 'pattern' and the formats 'email',
+// 'uuid', 'uri' and 'ipv4' of 'schema'.
+func stringValidationRules(schema *openapiv3.Schema) *validate.StringRules {
+	rules := &validate.StringRules{}
+	if schema.MinLength != 0 {
+		rules.MinLen = proto.Uint64(uint64(schema.MinLength))
+	}
+	if schema.MaxLength != 0 {
+		rules.MaxLen = proto.Uint64(uint64(schema.MaxLength))
+	}
+	if schema.Pattern != "" {
+		rules.Pattern = proto.String(schema.Pattern)
+	}
+	switch schema.Format {
+	case "email":
+		rules.WellKnown = &validate.StringRules_Email{Email: true}
+	case "uuid":
+		rules.WellKnown = &validate.StringRules_Uuid{Uuid: true}
+	case "uri":
+		rules.WellKnown = &validate.StringRules_Uri{Uri: true}
+	case "ipv4":
+		rules.WellKnown = &validate.StringRules_Ipv4{Ipv4: true}
+	}
+	return rules
+}
+
+// int32ValidationRules returns the rules for the keywords 'minimum' and 'maximum' of 'schema'.
+func int32ValidationRules(schema *openapiv3.Schema) *validate.Int32Rules {
+	rules := &validate.Int32Rules{}
+	if schema.ExclusiveMinimum || schema.Minimum != 0 {
+		bound, exclusive, ok := integerLowerBound(schema.Minimum, schema.ExclusiveMinimum, math.MinInt32, math.MaxInt32)
+		if ok && exclusive {
+			rules.GreaterThan = &validate.Int32Rules_Gt{Gt: int32(bound)}
+		} else if ok {
+			rules.GreaterThan = &validate.Int32Rules_Gte{Gte: int32(bound)}
+		}
+	}
+	if schema.ExclusiveMaximum || schema.Maximum != 0 {
+		bound, exclusive, ok := integerUpperBound(schema.Maximum, schema.ExclusiveMaximum, math.MinInt32, math.MaxInt32)
+		if ok && exclusive {
+			rules.LessThan = &validate.Int32Rules_Lt{Lt: int32(bound)}
+		} else if ok {
+			rules.LessThan = &validate.Int32Rules_Lte{Lte: int32(bound)}
+		}
+	}
+	return rules
+}
+
+// int64ValidationRules returns the rules for the keywords 'minimum' and 'maximum' of 'schema'.
+func int64ValidationRules(schema *openapiv3.Schema) *validate.Int64Rules {
+	rules := &validate.Int64Rules{}
+	if schema.ExclusiveMinimum || schema.Minimum != 0 {
+		bound, exclusive, ok := integerLowerBound(schema.Minimum, schema.ExclusiveMinimum, math.MinInt64, math.MaxInt64)
+		if ok && exclusive {
+			rules.GreaterThan = &validate.Int64Rules_Gt{Gt: bound}
+		} else if ok {
+			rules.GreaterThan = &validate.Int64Rules_Gte{Gte: bound}
+		}
+	}
+	if schema.ExclusiveMaximum || schema.Maximum != 0 {
+		bound, exclusive, ok := integerUpperBound(schema.Maximum, schema.ExclusiveMaximum, math.MinInt64, math.MaxInt64)
+		if ok && exclusive {
+			rules.LessThan = &validate.Int64Rules_Lt{Lt: bound}
+		} else if ok {
+			rules.LessThan = &validate.Int64Rules_Lte{Lte: bound}
+		}
+	}
+	return rules
+}
+
+// integerLowerBound converts the 'minimum' 'value' of a schema to a lower bound of integers between 'min' and 'max'
+// and whether it is exclusive. A fractional minimum is rounded up and becomes inclusive. It returns false, if all
+// integers of the range satisfy the minimum. A minimum above the range is clamped to an exclusive 'max', which no
+// integer satisfies. Keep in mind that float64(math.MaxInt64) is rounded up to 2^63.
+func integerLowerBound(value float64, exclusive bool, min int64, max int64) (int64, bool, bool) {
+	if value != math.Trunc(value) {
+		value = math.Ceil(value)
+		exclusive = false
+	}
+	if value < float64(min) || (value == float64(min) && !exclusive) {
+		return 0, false, false
+	}
+	if value >= float64(max)+1 {
+		return max, true, true
+	}
+	return int64(value), exclusive, true
+}
+
+// integerUpperBound converts the 'maximum' 'value' of a schema to an upper bound of integers between 'min' and 'max'
+// and whether it is exclusive. A fractional maximum is rounded down and becomes inclusive. It returns false, if all
+// integers of the range satisfy the maximum. A maximum below the range is clamped to an exclusive 'min', which no
+// integer satisfies.
+func integerUpperBound(value float64, exclusive bool, min int64, max int64) (int64, bool, bool) {
+	if value != math.Trunc(value) {
+		value = math.Floor(value)
+		exclusive = false
+	}
+	if value >= float64(max)+1 || (value == float64(max) && !exclusive) {
+		return 0, false, false
+	}
+	if value < float64(min) {
+		return min, true, true
+	}
+	return int64(value), exclusive, true
+}
+
+// floatValidationRules returns the rules for the keywords 'minimum' and 'maximum' of 'schema'.
+func floatValidationRules(schema *openapiv3.Schema) *validate.FloatRules {
+	rules := &validate.FloatRules{}
+	if schema.ExclusiveMinimum {
+		rules.GreaterThan = &validate.FloatRules_Gt{Gt: float32(schema.Minimum)}
+	} else if schema.Minimum != 0 {
+		rules.GreaterThan = &validate.FloatRules_Gte{Gte: float32(schema.Minimum)}
+	}
+	if schema.ExclusiveMaximum {
+		rules.LessThan = &validate.FloatRules_Lt{Lt: float32(schema.Maximum)}
+	} else if schema.Maximum != 0 {
+		rules.LessThan = &validate.FloatRules_Lte{Lte: float32(schema.Maximum)}
+	}
+	return rules
+}
+
+// doubleValidationRules returns the rules for the keywords 'minimum' and 'maximum' of 'schema'.
+func doubleValidationRules(schema *openapiv3.Schema) *validate.DoubleRules {
+	rules := &validate.DoubleRules{}
+	if schema.ExclusiveMinimum {
+		rules.GreaterThan = &validate.DoubleRules_Gt{Gt: schema.Minimum}
+	} else if schema.Minimum != 0 {
+		rules.GreaterThan = &validate.DoubleRules_Gte{Gte: schema.Minimum}
+	}
+	if schema.ExclusiveMaximum {
+		rules.LessThan = &validate.DoubleRules_Lt{Lt: schema.Maximum}
+	} else if schema.Maximum != 0 {
+		rules.LessThan = &validate.DoubleRules_Lte{Lte: schema.Maximum}
+	}
+	return rules
+}
@@ -0,0 +1,408 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	plugins "github.com/google/gnostic/plugins"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	dpb "google.golang.org/protobuf/types/descriptorpb"
+)
+
+// The range of valid field numbers and the range that is reserved for the implementation of protocol buffers.
+// Reference: https://developers.google.com/protocol-buffers/docs/proto3#assigning_field_numbers
+const (
+	minFieldNumber           = 1
+	maxFieldNumber           = 1<<29 - 1
+	firstReservedFieldNumber = 19000
+	lastReservedFieldNumber  = 19999
+)
+
+// pathVariable matches the variables of a path template of a HTTP rule (e.g.: '{book.name=shelves/*}').
+var pathVariable = regexp.MustCompile(`{([^}=]+)(=[^}]*)?}`)
+
+// origin is the OpenAPI element a message, field or RPC of a generated file was built from.
+type origin struct {
+	// The location of the OpenAPI description. Empty for the converted description itself, set for the descriptions of
+	// symbolic references.
+	location string
+	// The keys of the element inside of the description (e.g.: components, schemas, Book).
+	keys []string
+}
+
+// ValidationProblem is a problem of a generated .proto file.
+type ValidationProblem struct {
+	// The location of the OpenAPI description that caused the problem (see origin).
+	Location string
+	// The description of the problem and the keys of the OpenAPI element that caused it.
+	Message *plugins.Message
+}
+
+// String returns the problem together with the location and the keys of the OpenAPI element as JSON pointer.
+func (problem *ValidationProblem) String() string {
+	return problem.Location + keyPath(problem.Message.Keys) + ": " + problem.Message.Text
+}
+
+// ValidationError lists the problems of the generated .proto files that protoc would reject.
+type ValidationError struct {
+	Problems []*ValidationProblem
+}
+
+func (e *ValidationError) Error() string {
+	lines := []string{"the generated files are invalid:"}
+	for _, problem := range e.Problems {
+		lines = append(lines, problem.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// keyPath returns 'keys' as JSON pointer (e.g.: '#/paths/~1books/get' for the keys 'paths', '/books' and 'get').
+func keyPath(keys []string) string {
+	escaped := make([]string, 0)
+	for _, key := range keys {
+		key = strings.Replace(key, "~", "~0", -1)
+		escaped = append(escaped, strings.Replace(key, "/", "~1", -1))
+	}
+	return "#/" + strings.Join(escaped, "/")
+}
+
+// descriptorValidator collects the problems of a generated .proto file.
+type descriptorValidator struct {
+	renderer *Renderer
+	// All messages and enums of the file and its dependencies by their fully qualified name.
+	messages map[string]*dpb.DescriptorProto
+	enums    map[string]*dpb.EnumDescriptorProto
+	problems []*ValidationProblem
+}
+
+// validateFileDescriptors checks the file generated by 'renderer' and the files generated for its symbolic references.
+// Problems that protoc would reject (unresolvable types, invalid field numbers and map entries) are returned as
+// ValidationError. Problems of HTTP rules only affect gRPC-JSON transcoding, they are added to 'response' as warnings.
+func (renderer *Renderer) validateFileDescriptors(response *plugins.Response) error {
+	problems := make([]*ValidationProblem, 0)
+	for _, fdSet := range append([]*dpb.FileDescriptorSet{renderer.FdSet}, renderer.SymbolicFdSets...) {
+		problems = append(problems, renderer.validateFileDescriptor(fdSet)...)
+	}
+
+	errors := make([]*ValidationProblem, 0)
+	for _, problem := range problems {
+		if problem.Message.Level == plugins.Message_ERROR {
+			errors = append(errors, problem)
+			continue
+		}
+		if problem.Location != "" {
+			problem.Message.Text = problem.Location + ": " + problem.Message.Text
+		}
+		response.Messages = append(response.Messages, problem.Message)
+	}
+	if len(errors) > 0 {
+		return &ValidationError{Problems: errors}
+	}
+	return nil
+}
+
+// validateFileDescriptor checks the last file of 'fdSet': type references have to resolve, field numbers have to be
+// valid and unique, map entries have to be well-formed and HTTP rules have to refer to fields of the request message.
+func (renderer *Renderer) validateFileDescriptor(fdSet *dpb.FileDescriptorSet) []*ValidationProblem {
+	v := &descriptorValidator{
+		renderer: renderer,
+		messages: make(map[string]*dpb.DescriptorProto),
+		enums:    make(map[string]*dpb.EnumDescriptorProto),
+		problems: make([]*ValidationProblem, 0),
+	}
+	for _, fd := range fdSet.File {
+		v.addTypes(fd.GetPackage(), fd.MessageType, fd.EnumType)
+	}
+
+	fd := getLast(fdSet.File)
+	for _, message := range fd.MessageType {
+		v.validateMessage(message, fd.GetPackage()+"."+message.GetName(), origin{})
+	}
+	for _, service := range fd.Service {
+		for _, method := range service.Method {
+			v.validateMethod(method, fd.GetPackage())
+		}
+	}
+	return v.problems
+}
+
+// addTypes adds the messages 'messages' and the enums 'enums' that are defined inside of 'scope' (a package or the
+// fully qualified name of a message) and all of their nested types.
+func (v *descriptorValidator) addTypes(scope string, messages []*dpb.DescriptorProto, enums []*dpb.EnumDescriptorProto) {
+	for _, enum := range enums {
+		v.enums[scope+"."+enum.GetName()] = enum
+	}
+	for _, message := range messages {
+		name := scope + "." + message.GetName()
+		v.messages[name] = message
+		v.addTypes(name, message.NestedType, message.EnumType)
+	}
+}
+
+// resolve returns the fully qualified name of the message or enum 'name', which is referenced inside of 'scope'. Like
+// protoc the scope is searched from the innermost to the outermost. If the type can't be found, it returns an empty
+// string.
+func (v *descriptorValidator) resolve(name string, scope string) string {
+	if strings.HasPrefix(name, ".") {
+		scope, name = "", name[1:]
+	}
+	for {
+		candidate := name
+		if scope != "" {
+			candidate = scope + "." + name
+		}
+		if _, ok := v.messages[candidate]; ok {
+			return candidate
+		}
+		if _, ok := v.enums[candidate]; ok {
+			return candidate
+		}
+		if scope == "" {
+			return ""
+		}
+		scope = parentScope(scope)
+	}
+}
+
+// parentScope returns the scope that contains 'scope' (e.g.: 'bookstore' for 'bookstore.Book').
+func parentScope(scope string) string {
+	if i := strings.LastIndex(scope, "."); i >= 0 {
+		return scope[:i]
+	}
+	return ""
+}
+
+// origin returns the OpenAPI element 'element' was built from or 'parent', if it is not known.
+func (v *descriptorValidator) origin(element proto.Message, parent origin) origin {
+	if o, ok := v.renderer.origins[element]; ok && o.keys != nil {
+		return o
+	}
+	return parent
+}
+
+// addError adds a problem with the code 'code' and the description 'text' of the OpenAPI element 'o', which protoc
+// would reject.
+func (v *descriptorValidator) addError(code string, text string, o origin) {
+	msg := constructErrorMessage(code, text, copyKeys(o.keys))
+	v.problems = append(v.problems, &ValidationProblem{Location: o.location, Message: &msg})
+}
+
+// addWarning adds a problem with the code 'code' and the description 'text' of the OpenAPI element 'o', which protoc
+// would accept.
+func (v *descriptorValidator) addWarning(code string, text string, o origin) {
+	msg := constructWarningMessage(code, text, copyKeys(o.keys))
+	v.problems = append(v.problems, &ValidationProblem{Location: o.location, Message: &msg})
+}
+
+// validateMessage validates the fields and nested messages of 'message', which has the fully qualified name 'name'.
+func (v *descriptorValidator) validateMessage(message *dpb.DescriptorProto, name string, parent origin) {
+	o := v.origin(message, parent)
+	if message.GetOptions().GetMapEntry() {
+		v.validateMapEntry(message, name, o)
+	}
+
+	numbers := make(map[int32]string)
+	names := make(map[string]bool)
+	for _, field := range message.Field {
+		fieldOrigin := v.origin(field, o)
+		description := "The field '" + field.GetName() + "' of the message '" + name + "'"
+
+		if names[field.GetName()] {
+			v.addError("FIELDNAME", "The message '"+name+"' has several fields named '"+field.GetName()+"'", fieldOrigin)
+		}
+		names[field.GetName()] = true
+
+		number := field.GetNumber()
+		if number < minFieldNumber || number > maxFieldNumber {
+			v.addError("FIELDNUMBER", description+" has the number "+strconv.Itoa(int(number))+
+				", which is out of range", fieldOrigin)
+		} else if number >= firstReservedFieldNumber && number <= lastReservedFieldNumber {
+			v.addError("FIELDNUMBER", description+" has the number "+strconv.Itoa(int(number))+
+				", which is reserved for the implementation of protocol buffers", fieldOrigin)
+		} else if other, ok := numbers[number]; ok {
+			v.addError("FIELDNUMBER", description+" has the same number as the field '"+other+"'", fieldOrigin)
+		}
+		numbers[number] = field.GetName()
+
+		v.validateFieldType(field, name, description, fieldOrigin)
+	}
+
+	for _, nested := range message.NestedType {
+		v.validateMessage(nested, name+"."+nested.GetName(), o)
+	}
+}
+
+// validateFieldType checks that the type of 'field' of the message 'name' resolves to a message or an enum, if the field
+// has such a type. Map entries have to be nested inside of the message and the field has to be repeated.
+func (v *descriptorValidator) validateFieldType(field *dpb.FieldDescriptorProto, name string, description string, o origin) {
+	fieldType := field.GetType()
+	if fieldType != dpb.FieldDescriptorProto_TYPE_MESSAGE && fieldType != dpb.FieldDescriptorProto_TYPE_ENUM {
+		return
+	}
+
+	typeName := v.resolve(field.GetTypeName(), name)
+	if typeName == "" {
+		v.addError("TYPEREFERENCE", description+" has the type '"+field.GetTypeName()+"', which can't be resolved", o)
+		return
+	}
+	_, isEnum := v.enums[typeName]
+	if isEnum && fieldType == dpb.FieldDescriptorProto_TYPE_MESSAGE {
+		v.addError("TYPEREFERENCE", description+" is a message, but its type '"+typeName+"' is an enum", o)
+		return
+	}
+	if !isEnum && fieldType == dpb.FieldDescriptorProto_TYPE_ENUM {
+		v.addError("TYPEREFERENCE", description+" is an enum, but its type '"+typeName+"' is a message", o)
+		return
+	}
+
+	if entry, ok := v.messages[typeName]; ok && entry.GetOptions().GetMapEntry() {
+		if parentScope(typeName) != name {
+			v.addError("MAPENTRY", description+" is a map, but its entry '"+typeName+"' is not nested inside of "+
+				"the message", o)
+		}
+		if field.GetLabel() != dpb.FieldDescriptorProto_LABEL_REPEATED {
+			v.addError("MAPENTRY", description+" is a map, but it is not repeated", o)
+		}
+	}
+}
+
+// validateMapEntry checks that the map entry 'entry' with the fully qualified name 'name' has a field 'key' with the
+// number 1 and a valid key type, and a field 'value' with the number 2.
+// Reference: https://developers.google.com/protocol-buffers/docs/proto3#backwards_compatibility
+func (v *descriptorValidator) validateMapEntry(entry *dpb.DescriptorProto, name string, o origin) {
+	description := "The map entry '" + name + "'"
+	if !strings.HasSuffix(entry.GetName(), "Entry") {
+		v.addError("MAPENTRY", description+" has to be named '<Field>Entry'", o)
+	}
+	if len(entry.Field) != 2 || entry.Field[0].GetName() != "key" || entry.Field[0].GetNumber() != 1 ||
+		entry.Field[1].GetName() != "value" || entry.Field[1].GetNumber() != 2 {
+		v.addError("MAPENTRY", description+" has to consist of the fields 'key' = 1 and 'value' = 2", o)
+		return
+	}
+	switch entry.Field[0].GetType() {
+	case dpb.FieldDescriptorProto_TYPE_DOUBLE, dpb.FieldDescriptorProto_TYPE_FLOAT, dpb.FieldDescriptorProto_TYPE_BYTES,
+		dpb.FieldDescriptorProto_TYPE_MESSAGE, dpb.FieldDescriptorProto_TYPE_ENUM, dpb.FieldDescriptorProto_TYPE_GROUP:
+		v.addError("MAPENTRY", description+" has the key type "+entry.Field[0].GetType().String()+
+			", only integral and string types are allowed", o)
+	}
+}
+
+// validateMethod checks that the request and response messages of 'method' (inside of the package 'packageName')
+// resolve and that its HTTP rule refers to fields of them.
+func (v *descriptorValidator) validateMethod(method *dpb.MethodDescriptorProto, packageName string) {
+	o := v.origin(method, origin{})
+	description := "The RPC '" + method.GetName() + "'"
+
+	input := v.resolveMessage(method.GetInputType(), packageName, description+" has the request", o)
+	output := v.resolveMessage(method.GetOutputType(), packageName, description+" has the response", o)
+	if method.GetOptions() == nil || !proto.HasExtension(method.GetOptions(), annotations.E_Http) {
+		return
+	}
+	rule := proto.GetExtension(method.GetOptions(), annotations.E_Http).(*annotations.HttpRule)
+
+	path := httpRulePath(rule)
+	if !strings.HasPrefix(path, "/") {
+		v.addWarning("HTTPRULE", description+" has the path '"+path+"', which doesn't start with '/'", o)
+	}
+	if input == "" {
+		return
+	}
+	for _, match := range pathVariable.FindAllStringSubmatch(path, -1) {
+		field := v.findFieldPath(input, match[1])
+		if field == nil {
+			v.addWarning("HTTPRULE", description+" has the path variable '"+match[1]+"', which is not a field of the "+
+				"request '"+method.GetInputType()+"'", o)
+		} else if field.GetLabel() == dpb.FieldDescriptorProto_LABEL_REPEATED ||
+			field.GetType() == dpb.FieldDescriptorProto_TYPE_MESSAGE {
+			v.addWarning("HTTPRULE", description+" has the path variable '"+match[1]+"', which refers to a "+
+				"repeated field or a message", o)
+		}
+	}
+	if body := rule.GetBody(); body != "" && body != "*" && findField(v.messages[input], body) == nil {
+		v.addWarning("HTTPRULE", description+" has the body '"+body+"', which is not a field of the request '"+
+			method.GetInputType()+"'", o)
+	}
+	if responseBody := rule.GetResponseBody(); output != "" && responseBody != "" &&
+		findField(v.messages[output], responseBody) == nil {
+		v.addWarning("HTTPRULE", description+" has the response body '"+responseBody+"', which is not a field of "+
+			"the response '"+method.GetOutputType()+"'", o)
+	}
+}
+
+// resolveMessage returns the fully qualified name of the message 'typeName', which is referenced inside of the package
+// 'packageName'. If there is no such message, a problem starting with 'description' is added and an empty string is
+// returned.
+func (v *descriptorValidator) resolveMessage(typeName string, packageName string, description string, o origin) string {
+	name := v.resolve(typeName, packageName)
+	if _, ok := v.messages[name]; !ok {
+		v.addError("TYPEREFERENCE", description+" '"+typeName+"', which is not a message", o)
+		return ""
+	}
+	return name
+}
+
+// findFieldPath returns the field the path 'fieldPath' (e.g.: 'book.name') refers to, starting at the message 'name'. If
+// there is no such field, nil is returned.
+func (v *descriptorValidator) findFieldPath(name string, fieldPath string) *dpb.FieldDescriptorProto {
+	segments := strings.Split(fieldPath, ".")
+	for i, segment := range segments {
+		field := findField(v.messages[name], segment)
+		if field == nil || i == len(segments)-1 {
+			return field
+		}
+		if field.GetType() != dpb.FieldDescriptorProto_TYPE_MESSAGE ||
+			field.GetLabel() == dpb.FieldDescriptorProto_LABEL_REPEATED {
+			return nil
+		}
+		name = v.resolve(field.GetTypeName(), name)
+	}
+	return nil
+}
+
+// findField returns the field named 'name' of 'message' or nil.
+func findField(message *dpb.DescriptorProto, name string) *dpb.FieldDescriptorProto {
+	if message == nil {
+		return nil
+	}
+	for _, field := range message.Field {
+		if field.GetName() == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// httpRulePath returns the path template of 'rule'.
+func httpRulePath(rule *annotations.HttpRule) string {
+	switch pattern := rule.Pattern.(type) {
+	case *annotations.HttpRule_Get:
+		return pattern.Get
+	case *annotations.HttpRule_Put:
+		return pattern.Put
+	case *annotations.HttpRule_Post:
+		return pattern.Post
+	case *annotations.HttpRule_Delete:
+		return pattern.Delete
+	case *annotations.HttpRule_Patch:
+		return pattern.Patch
+	case *annotations.HttpRule_Custom:
+		return pattern.Custom.GetPath()
+	}
+	return ""
+}
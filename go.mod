@@ -1,15 +1,26 @@
 module github.com/googleapis/gnostic-grpc
 
-go 1.13
+go 1.23
 
 require (
-	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b
-	github.com/golang/protobuf v1.4.2
-	github.com/googleapis/gnostic v0.5.1
-	github.com/grpc-ecosystem/grpc-gateway v1.12.2
-	github.com/jhump/protoreflect v1.6.0
-	golang.org/x/net v0.0.0-20191002035440-2ec189313ef0
-	google.golang.org/genproto v0.0.0-20200311144346-b662892dd51b
-	google.golang.org/grpc v1.27.0
-	gopkg.in/yaml.v2 v2.2.8 // indirect
+	buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go v1.36.10-20250912141014-52f32327d4b0.1
+	github.com/golang/glog v1.1.0
+	github.com/golang/protobuf v1.5.4
+	github.com/google/gnostic v0.6.9
+	github.com/grpc-ecosystem/grpc-gateway v1.16.0
+	github.com/jhump/protoreflect v1.15.6
+	golang.org/x/net v0.17.0
+	google.golang.org/genproto v0.0.0-20230526161137-0005af68ea54
+	google.golang.org/genproto/googleapis/api v0.0.0-20230525234035-dd9d682886f9
+	google.golang.org/grpc v1.57.1
+	google.golang.org/protobuf v1.36.10
+)
+
+require (
+	github.com/bufbuild/protocompile v0.8.0 // indirect
+	golang.org/x/sync v0.5.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20230525234030-28d5490b6b19 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -15,9 +15,81 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/googleapis/gnostic-grpc/generator"
+	plugins "github.com/google/gnostic/plugins"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "common" {
+		runCommonGenerator(os.Args[2:])
+		return
+	}
 	generator.RunProtoGenerator()
 }
+
+// runCommonGenerator generates the .proto files for several OpenAPI descriptions, which share their common messages
+// through 'common.proto'. Usage:
+//
+//	gnostic-grpc common [-output directory] [-parameters key=value,...] input1.yaml input2.yaml ...
+func runCommonGenerator(args []string) {
+	flags := flag.NewFlagSet("common", flag.ExitOnError)
+	output := flags.String("output", ".", "Output directory")
+	parameters := flags.String("parameters", "", "Comma separated parameters of the plugin (e.g.: naming=aip,layout=split)")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	response, err := generator.RunCommonGenerator(flags.Args(), parseParameters(*parameters))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, message := range response.Messages {
+		fmt.Fprintf(os.Stderr, "%s: %s (%s)\n", message.Level, message.Text, strings.Join(message.Keys, "/"))
+	}
+	if err := writeFiles(*output, response.Files); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// writeFiles writes 'files' into the directory 'output'. The names of the files may contain directories (e.g.: with
+// 'layout=split'), which are created if they don't exist.
+func writeFiles(output string, files []*plugins.File) error {
+	for _, file := range files {
+		path := filepath.Join(output, file.Name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, file.Data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseParameters parses parameters of the form 'key=value,key2=value2'.
+func parseParameters(parameters string) []*plugins.Parameter {
+	result := make([]*plugins.Parameter, 0)
+	for _, parameter := range strings.Split(parameters, ",") {
+		if parameter == "" {
+			continue
+		}
+		pair := strings.SplitN(parameter, "=", 2)
+		value := ""
+		if len(pair) == 2 {
+			value = pair[1]
+		}
+		result = append(result, &plugins.Parameter{Name: pair[0], Value: value})
+	}
+	return result
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	plugins "github.com/google/gnostic/plugins"
+)
+
+func TestWriteFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "common")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The files of symbolic references are written into subdirectories.
+	files := []*plugins.File{
+		{Name: "common.proto", Data: []byte("package common;")},
+		{Name: "c/types.proto", Data: []byte("package types;")},
+	}
+	if err := writeFiles(dir, files); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != string(file.Data) {
+			t.Errorf("unexpected contents of %s: %s", file.Name, data)
+		}
+	}
+}